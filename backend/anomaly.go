@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+)
+
+// default reference period for anomalies (WMO 1961–1990 climate normal)
+const (
+	defaultAnomalyRefStart = 1961
+	defaultAnomalyRefEnd   = 1990
+)
+
+// AnomalyReference describes the reference means the anomalies are based on.
+// Annual holds the mean per element, Seasonal the mean per season and element.
+type AnomalyReference struct {
+	RefStart int                           `json:"refStart"`
+	RefEnd   int                           `json:"refEnd"`
+	Annual   map[string]float64            `json:"annual"`
+	Seasonal map[string]map[string]float64 `json:"seasonal"`
+}
+
+// annualValues returns the element values of a year by element name
+func annualValues(a *AnnualStationData) map[string]**float64 {
+	return map[string]**float64{
+		"TMIN": &a.TMin, "TMAX": &a.TMax, "PRCP": &a.Prcp, "SNOW": &a.Snow, "SNWD": &a.Snwd,
+	}
+}
+
+// seasonalValues returns the element values of a season by element name
+func seasonalValues(s *SeasonalStationData) map[string]**float64 {
+	return map[string]**float64{
+		"TMIN": &s.TMin, "TMAX": &s.TMax, "PRCP": &s.Prcp, "SNOW": &s.Snow, "SNWD": &s.Snwd,
+	}
+}
+
+// referenceMean returns the mean of the values, if at least minCount are given
+func referenceMean(values []float64, minCount int) (float64, bool) {
+	if len(values) == 0 || len(values) < minCount {
+		return 0, false
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values)), true
+}
+
+// deviate replaces the value by its deviation from the reference,
+// values without a reference become nil.
+func deviate(val **float64, ref float64, ok bool) {
+	if *val == nil {
+		return
+	}
+	if !ok {
+		*val = nil
+		return
+	}
+	d := math.Round((**val-ref)*10) / 10
+	*val = &d
+}
+
+// calculateAnomalies turns the annual and seasonal series into deviations from
+// their refStart–refEnd mean, in place. A reference mean needs valid values in
+// at least 80 % of the reference years (as for normals).
+func calculateAnomalies(annual []*AnnualStationData, seasonal []*SeasonalStationData, refStart int, refEnd int, southernHemisphere bool) *AnomalyReference {
+	minYears := defaultMinNormalsYears(refStart, refEnd)
+	ref := &AnomalyReference{
+		RefStart: refStart,
+		RefEnd:   refEnd,
+		Annual:   make(map[string]float64),
+		Seasonal: make(map[string]map[string]float64),
+	}
+
+	refValues := make(map[string][]float64)
+	for _, a := range annual {
+		if a.Year < refStart || a.Year > refEnd {
+			continue
+		}
+		for element, val := range annualValues(a) {
+			if *val != nil {
+				refValues[element] = append(refValues[element], **val)
+			}
+		}
+	}
+	for element, values := range refValues {
+		if mean, ok := referenceMean(values, minYears); ok {
+			ref.Annual[element] = mean
+		}
+	}
+	for _, a := range annual {
+		for element, val := range annualValues(a) {
+			mean, ok := ref.Annual[element]
+			deviate(val, mean, ok)
+		}
+	}
+
+	seasonRefValues := make(map[string]map[string][]float64)
+	for _, s := range seasonal {
+		if year := seasonReferenceYear(s, southernHemisphere); year < refStart || year > refEnd {
+			continue
+		}
+		if _, ok := seasonRefValues[s.Season]; !ok {
+			seasonRefValues[s.Season] = make(map[string][]float64)
+		}
+		for element, val := range seasonalValues(s) {
+			if *val != nil {
+				seasonRefValues[s.Season][element] = append(seasonRefValues[s.Season][element], **val)
+			}
+		}
+	}
+	for season, elements := range seasonRefValues {
+		for element, values := range elements {
+			if mean, ok := referenceMean(values, minYears); ok {
+				if _, exists := ref.Seasonal[season]; !exists {
+					ref.Seasonal[season] = make(map[string]float64)
+				}
+				ref.Seasonal[season][element] = mean
+			}
+		}
+	}
+	for _, s := range seasonal {
+		for element, val := range seasonalValues(s) {
+			mean, ok := ref.Seasonal[s.Season][element]
+			deviate(val, mean, ok)
+		}
+	}
+
+	// report the reference means rounded like the series
+	for element, mean := range ref.Annual {
+		ref.Annual[element] = math.Round(mean*10) / 10
+	}
+	for _, elements := range ref.Seasonal {
+		for element, mean := range elements {
+			elements[element] = math.Round(mean*10) / 10
+		}
+	}
+	return ref
+}
+
+// parseAnomalyParams reads anomaly=true and the optional refStart/refEnd years.
+func parseAnomalyParams(q url.Values) (bool, int, int, error) {
+	refStart, refEnd := defaultAnomalyRefStart, defaultAnomalyRefEnd
+	anomaly := false
+	var err error
+	if s := q.Get("anomaly"); s != "" {
+		if anomaly, err = strconv.ParseBool(s); err != nil {
+			return false, 0, 0, fmt.Errorf("invalid anomaly value %q", s)
+		}
+	}
+	if s := q.Get("refStart"); s != "" {
+		if refStart, err = strconv.Atoi(s); err != nil {
+			return false, 0, 0, fmt.Errorf("invalid refStart year %q", s)
+		}
+	}
+	if s := q.Get("refEnd"); s != "" {
+		if refEnd, err = strconv.Atoi(s); err != nil {
+			return false, 0, 0, fmt.Errorf("invalid refEnd year %q", s)
+		}
+	}
+	if refEnd < refStart {
+		return false, 0, 0, fmt.Errorf("refStart %d is after refEnd %d", refStart, refEnd)
+	}
+	return anomaly, refStart, refEnd, nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestCalculateAnomalies_Annual(t *testing.T) {
+	annual := []*AnnualStationData{
+		{Year: 1990, TMin: floatPtr(5.0), TMax: floatPtr(14.0)},
+		{Year: 1991, TMin: floatPtr(7.0), TMax: floatPtr(16.0), Prcp: floatPtr(600)},
+		{Year: 2020, TMin: floatPtr(7.5), TMax: nil, Prcp: floatPtr(550)},
+	}
+
+	ref := calculateAnomalies(annual, nil, 1990, 1991, false)
+	if !approxEqual(ref.Annual["TMIN"], 6.0, 0.001) || !approxEqual(ref.Annual["TMAX"], 15.0, 0.001) {
+		t.Errorf("unexpected reference means: %v", ref.Annual)
+	}
+	// PRCP exists in only 1 of 2 reference years, below the 80 % requirement
+	if _, ok := ref.Annual["PRCP"]; ok {
+		t.Error("expected no PRCP reference from a single year")
+	}
+
+	if !approxEqual(*annual[0].TMin, -1.0, 0.001) || !approxEqual(*annual[2].TMin, 1.5, 0.001) {
+		t.Errorf("unexpected TMIN anomalies: %f, %f", *annual[0].TMin, *annual[2].TMin)
+	}
+	if !approxEqual(*annual[1].TMax, 1.0, 0.001) {
+		t.Errorf("expected TMAX anomaly 1.0, got %f", *annual[1].TMax)
+	}
+	if annual[2].TMax != nil {
+		t.Error("expected missing value to stay nil")
+	}
+	if annual[1].Prcp != nil || annual[2].Prcp != nil {
+		t.Error("expected PRCP without reference to become nil")
+	}
+}
+
+func TestCalculateAnomalies_SeasonalUsesReferenceYearOfJanuary(t *testing.T) {
+	seasonal := []*SeasonalStationData{
+		// winter 1989 (Dec 1989–Feb 1990) belongs to 1990
+		{Year: 1989, Season: "Winter", TMin: floatPtr(-4.0)},
+		{Year: 1990, Season: "Winter", TMin: floatPtr(-2.0)},
+		{Year: 1990, Season: "Summer", TMin: floatPtr(12.0)},
+		// winter 1990 (Dec 1990–Feb 1991) is outside 1990–1990
+		{Year: 2000, Season: "Winter", TMin: floatPtr(-1.0)},
+	}
+
+	ref := calculateAnomalies(nil, seasonal, 1990, 1990, false)
+	if !approxEqual(ref.Seasonal["Winter"]["TMIN"], -4.0, 0.001) {
+		t.Errorf("expected winter reference -4.0, got %v", ref.Seasonal["Winter"])
+	}
+	if !approxEqual(*seasonal[3].TMin, 3.0, 0.001) {
+		t.Errorf("expected winter 2000 anomaly 3.0, got %f", *seasonal[3].TMin)
+	}
+	if !approxEqual(*seasonal[2].TMin, 0.0, 0.001) {
+		t.Errorf("expected summer 1990 anomaly 0.0, got %f", *seasonal[2].TMin)
+	}
+}
+
+func TestParseAnomalyParams(t *testing.T) {
+	anomaly, from, to, err := parseAnomalyParams(url.Values{})
+	if err != nil || anomaly || from != 1961 || to != 1990 {
+		t.Errorf("unexpected defaults: %v %d %d (%v)", anomaly, from, to, err)
+	}
+	anomaly, from, to, err = parseAnomalyParams(url.Values{"anomaly": {"true"}, "refStart": {"1981"}, "refEnd": {"2010"}})
+	if err != nil || !anomaly || from != 1981 || to != 2010 {
+		t.Errorf("unexpected params: %v %d %d (%v)", anomaly, from, to, err)
+	}
+	if _, _, _, err := parseAnomalyParams(url.Values{"refStart": {"2000"}, "refEnd": {"1990"}}); err == nil {
+		t.Error("expected error for refStart after refEnd")
+	}
+	if _, _, _, err := parseAnomalyParams(url.Values{"anomaly": {"yes please"}}); err == nil {
+		t.Error("expected error for invalid anomaly value")
+	}
+}
+
+func TestStationHandler_AnomalyMode(t *testing.T) {
+	setupCache(t)
+
+	rawData := completeYears(2000, 2002,
+		func(y int, m time.Month) int { return (y - 2000) * 10 },
+		func(y int, m time.Month) int { return 200 },
+	)
+	cache.put("TESTSTATION", newStationData(rawData), stationVersion{}, time.Now())
+
+	req := httptest.NewRequest(http.MethodGet, "/station?id=TESTSTATION&anomaly=true&refStart=2000&refEnd=2001", nil)
+	rec := httptest.NewRecorder()
+	stationHandler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var resp struct {
+		Data     StationDetailResponse `json:"data"`
+		ErrorMsg string                `json:"errorMessage"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.ErrorMsg != "" {
+		t.Errorf("expected no error, got %q", resp.ErrorMsg)
+	}
+	if resp.Data.Anomaly == nil || resp.Data.Anomaly.RefStart != 2000 || !approxEqual(resp.Data.Anomaly.Annual["TMIN"], 0.5, 0.001) {
+		t.Fatalf("unexpected reference: %+v", resp.Data.Anomaly)
+	}
+	// TMIN 2002 = 2.0 °C, reference 0.5 °C
+	last := resp.Data.Annual[2]
+	if last.Year != 2002 || last.TMin == nil || !approxEqual(*last.TMin, 1.5, 0.001) {
+		t.Errorf("expected 2002 TMIN anomaly 1.5, got %+v", last)
+	}
+	if last.TMax == nil || !approxEqual(*last.TMax, 0.0, 0.001) {
+		t.Errorf("expected 2002 TMAX anomaly 0.0, got %v", last.TMax)
+	}
+
+	// no data in the reference period
+	req = httptest.NewRequest(http.MethodGet, "/station?id=TESTSTATION&anomaly=true", nil)
+	rec = httptest.NewRecorder()
+	stationHandler(rec, req)
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if resp.ErrorMsg == "" {
+		t.Error("expected error message without reference data")
+	}
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// maximum size of a POSTed GeoJSON body
+const maxGeoJSONBytes = 1 << 20
+
+// stationArea is a region on the map stations can be searched in
+type stationArea interface {
+	// boxes returns bounding boxes covering the area
+	boxes() []boundingBox
+	contains(lat float64, long float64) bool
+}
+
+// boundingBox spans minLon..maxLon and minLat..maxLat in degrees.
+// A box with minLon > maxLon crosses the antimeridian.
+type boundingBox struct {
+	MinLon, MinLat, MaxLon, MaxLat float64
+}
+
+func (b boundingBox) boxes() []boundingBox {
+	if b.MinLon <= b.MaxLon {
+		return []boundingBox{b}
+	}
+	return []boundingBox{
+		{MinLon: b.MinLon, MinLat: b.MinLat, MaxLon: 180, MaxLat: b.MaxLat},
+		{MinLon: -180, MinLat: b.MinLat, MaxLon: b.MaxLon, MaxLat: b.MaxLat},
+	}
+}
+
+func (b boundingBox) contains(lat float64, long float64) bool {
+	if lat < b.MinLat || lat > b.MaxLat {
+		return false
+	}
+	if b.MinLon <= b.MaxLon {
+		return long >= b.MinLon && long <= b.MaxLon
+	}
+	return long >= b.MinLon || long <= b.MaxLon
+}
+
+// parseBBox parses "minLon,minLat,maxLon,maxLat"
+func parseBBox(s string) (boundingBox, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return boundingBox{}, fmt.Errorf("bbox needs 4 values, got %d", len(parts))
+	}
+	var values [4]float64
+	for i, p := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return boundingBox{}, fmt.Errorf("invalid bbox value %q", p)
+		}
+		values[i] = v
+	}
+	b := boundingBox{MinLon: values[0], MinLat: values[1], MaxLon: values[2], MaxLat: values[3]}
+	if err := checkPosition(b.MinLon, b.MinLat); err != nil {
+		return boundingBox{}, err
+	}
+	if err := checkPosition(b.MaxLon, b.MaxLat); err != nil {
+		return boundingBox{}, err
+	}
+	if b.MinLat > b.MaxLat {
+		return boundingBox{}, fmt.Errorf("minLat %g is above maxLat %g", b.MinLat, b.MaxLat)
+	}
+	return b, nil
+}
+
+func checkPosition(long float64, lat float64) error {
+	if long < -180 || long > 180 || lat < -90 || lat > 90 {
+		return fmt.Errorf("position %g,%g is out of range", long, lat)
+	}
+	return nil
+}
+
+// geoPolygons is a GeoJSON Polygon or MultiPolygon. Every polygon is a list
+// of linear rings of [lon, lat] positions, the first ring is the outer
+// boundary and the others are holes.
+type geoPolygons [][][][2]float64
+
+func (g geoPolygons) boxes() []boundingBox {
+	var boxes []boundingBox
+	for _, polygon := range g {
+		b := boundingBox{MinLon: 180, MinLat: 90, MaxLon: -180, MaxLat: -90}
+		for _, p := range polygon[0] {
+			b.MinLon = min(b.MinLon, p[0])
+			b.MaxLon = max(b.MaxLon, p[0])
+			b.MinLat = min(b.MinLat, p[1])
+			b.MaxLat = max(b.MaxLat, p[1])
+		}
+		boxes = append(boxes, b)
+	}
+	return boxes
+}
+
+func (g geoPolygons) contains(lat float64, long float64) bool {
+	for _, polygon := range g {
+		if !ringContains(polygon[0], lat, long) {
+			continue
+		}
+		inHole := false
+		for _, hole := range polygon[1:] {
+			if ringContains(hole, lat, long) {
+				inHole = true
+				break
+			}
+		}
+		if !inHole {
+			return true
+		}
+	}
+	return false
+}
+
+// ringContains tests if the point lies inside the ring (ray casting)
+func ringContains(ring [][2]float64, lat float64, long float64) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		xi, yi := ring[i][0], ring[i][1]
+		xj, yj := ring[j][0], ring[j][1]
+		if (yi > lat) != (yj > lat) && long < (xj-xi)*(lat-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// parseGeoJSON reads a Polygon or MultiPolygon geometry, optionally wrapped
+// in a Feature.
+func parseGeoJSON(data []byte) (geoPolygons, error) {
+	var geometry struct {
+		Type        string          `json:"type"`
+		Coordinates json.RawMessage `json:"coordinates"`
+		Geometry    json.RawMessage `json:"geometry"`
+	}
+	if err := json.Unmarshal(data, &geometry); err != nil {
+		return nil, fmt.Errorf("invalid GeoJSON: %v", err)
+	}
+
+	var polygons geoPolygons
+	switch geometry.Type {
+	case "Feature":
+		if len(geometry.Geometry) == 0 || string(geometry.Geometry) == "null" {
+			return nil, errors.New("feature without geometry")
+		}
+		return parseGeoJSON(geometry.Geometry)
+	case "Polygon":
+		var polygon [][][2]float64
+		if err := json.Unmarshal(geometry.Coordinates, &polygon); err != nil {
+			return nil, fmt.Errorf("invalid Polygon coordinates: %v", err)
+		}
+		polygons = geoPolygons{polygon}
+	case "MultiPolygon":
+		if err := json.Unmarshal(geometry.Coordinates, &polygons); err != nil {
+			return nil, fmt.Errorf("invalid MultiPolygon coordinates: %v", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported GeoJSON type %q, expected Polygon or MultiPolygon", geometry.Type)
+	}
+
+	if len(polygons) == 0 {
+		return nil, errors.New("no polygons given")
+	}
+	for _, polygon := range polygons {
+		if len(polygon) == 0 {
+			return nil, errors.New("polygon without rings")
+		}
+		for _, ring := range polygon {
+			if len(ring) < 4 || ring[0] != ring[len(ring)-1] {
+				return nil, errors.New("a linear ring needs at least 4 positions and must be closed")
+			}
+			for _, p := range ring {
+				if err := checkPosition(p[0], p[1]); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return polygons, nil
+}
+
+// withinBox calls fn for every station inside the bounding box, which must
+// not cross the antimeridian
+func (g *stationGrid) withinBox(b boundingBox, fn func(s *Station)) {
+	firstCol, lastCol := gridCol(b.MinLon), gridCol(b.MaxLon)
+	if b.MaxLon >= 180 {
+		lastCol = gridCols - 1
+	}
+	for row := gridRow(b.MinLat); row <= gridRow(b.MaxLat); row++ {
+		for col := firstCol; col <= lastCol; col++ {
+			for _, s := range g.cells[row*gridCols+col] {
+				if b.contains(*s.Latitude, *s.Longitude) {
+					fn(s)
+				}
+			}
+		}
+	}
+}
+
+// stationsInArea calls fn once for every station inside the area
+func stationsInArea(area stationArea, fn func(s *Station)) {
+	seen := make(map[*Station]bool)
+	for _, b := range area.boxes() {
+		stationIndex.withinBox(b, func(s *Station) {
+			if seen[s] || !area.contains(*s.Latitude, *s.Longitude) {
+				return
+			}
+			seen[s] = true
+			fn(s)
+		})
+	}
+}
+
+// findStationsInArea works like findStations for a bounding box or polygon,
+// the stations are sorted by ID. A limit of 0 returns all stations.
+func findStationsInArea(area stationArea, limit int, filter stationFilter) ([]*Station, error) {
+	stations := []*Station{}
+	stationsInArea(area, func(s *Station) {
+		//filtering with inventory file if station has data available in given years
+		if !filter.matches(s) {
+			return
+		}
+		matchedStation := *s
+		stations = append(stations, &matchedStation)
+	})
+
+	slices.SortFunc(stations, func(a, b *Station) int { return strings.Compare(a.ID, b.ID) })
+	if filter.MinCoverage > 0 {
+		return filterByCoverage(stations, filter, limit)
+	}
+	if limit > 0 && len(stations) > limit {
+		stations = stations[:limit]
+	}
+	return stations, nil
+}
+
+// countStationsInArea counts the stations in the area matching the filter,
+// ignoring the years (see countStationsInRadius)
+func countStationsInArea(area stationArea, filter stationFilter) int {
+	count := 0
+	stationsInArea(area, func(s *Station) {
+		if filter.matchesIgnoringYears(s) {
+			count++
+		}
+	})
+	return count
+}
+
+// areaStationsHandler serves /stations?bbox=minLon,minLat,maxLon,maxLat and
+// POST /stations with a GeoJSON Polygon/MultiPolygon body.
+// start and end are required, limit is optional.
+func areaStationsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	startDateStr := q.Get("start")
+	endDateStr := q.Get("end")
+	limitStr := q.Get("limit")
+	enc := json.NewEncoder(w)
+
+	var area stationArea
+	if r.Method == http.MethodPost {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxGeoJSONBytes))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			response := Response{Data: []*Station{}, ErrorMsg: "Please provide a GeoJSON body of at most 1 MB."}
+			enc.Encode(response)
+			return
+		}
+		polygons, err := parseGeoJSON(body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			response := Response{Data: []*Station{}, ErrorMsg: "Please provide a valid GeoJSON Polygon or MultiPolygon: " + err.Error()}
+			enc.Encode(response)
+			return
+		}
+		area = polygons
+	} else {
+		box, err := parseBBox(q.Get("bbox"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			response := Response{Data: []*Station{}, ErrorMsg: "Please provide a valid bbox (minLon,minLat,maxLon,maxLat)."}
+			enc.Encode(response)
+			return
+		}
+		area = box
+	}
+
+	if startDateStr == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		response := Response{Data: []*Station{}, ErrorMsg: "Please provide a start year."}
+		enc.Encode(response)
+		return
+	}
+	if endDateStr == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		response := Response{Data: []*Station{}, ErrorMsg: "Please provide an end year."}
+		enc.Encode(response)
+		return
+	}
+	start, err := strconv.Atoi(startDateStr)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := Response{Data: []*Station{}, ErrorMsg: "Please provide a valid number."}
+		enc.Encode(response)
+		return
+	}
+	end, err := strconv.Atoi(endDateStr)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := Response{Data: []*Station{}, ErrorMsg: "Please provide a valid number."}
+		enc.Encode(response)
+		return
+	}
+	limit := 0
+	if limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			response := Response{Data: []*Station{}, ErrorMsg: "Please provide a valid number."}
+			enc.Encode(response)
+			return
+		}
+	}
+	filter, err := parseStationFilter(q)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := Response{Data: []*Station{}, ErrorMsg: err.Error()}
+		enc.Encode(response)
+		return
+	}
+	filter.StartYear, filter.EndYear = start, end
+
+	stationList, err := findStationsInArea(area, limit, filter)
+
+	errMsg := ""
+	if err != nil {
+		//stations with unknown coverage were left out, the list is partial
+		errMsg = err.Error()
+	} else if len(stationList) == 0 {
+		geoCount := countStationsInArea(area, filter)
+		if geoCount > 0 {
+			errMsg = fmt.Sprintf("There are %d stations in this area, but none have data for the selected time range (%d–%d). Try adjusting the start/end year.", geoCount, start, end)
+		} else {
+			errMsg = "No stations found in this area. Try zooming out."
+		}
+	}
+
+	response := Response{Data: stationList, ErrorMsg: errMsg}
+	enc.Encode(response)
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseBBox(t *testing.T) {
+	b, err := parseBBox("5.9,47.3,15.0,55.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if b != (boundingBox{MinLon: 5.9, MinLat: 47.3, MaxLon: 15.0, MaxLat: 55.1}) {
+		t.Errorf("unexpected box %+v", b)
+	}
+
+	for _, s := range []string{"", "1,2,3", "a,2,3,4", "0,50,10,40", "0,-91,10,10", "-181,0,10,10"} {
+		if _, err := parseBBox(s); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
+
+func TestBoundingBox_Antimeridian(t *testing.T) {
+	b := boundingBox{MinLon: 170, MinLat: -20, MaxLon: -170, MaxLat: 0}
+	if len(b.boxes()) != 2 {
+		t.Fatalf("expected the box to be split in 2, got %d", len(b.boxes()))
+	}
+	if !b.contains(-10, 175) || !b.contains(-10, -175) {
+		t.Error("expected points on both sides of the antimeridian to be inside")
+	}
+	if b.contains(-10, 0) || b.contains(10, 175) {
+		t.Error("expected points outside the box to be outside")
+	}
+}
+
+func TestParseGeoJSON(t *testing.T) {
+	square := `[[[0,0],[10,0],[10,10],[0,10],[0,0]]]`
+	valid := []string{
+		`{"type":"Polygon","coordinates":` + square + `}`,
+		`{"type":"MultiPolygon","coordinates":[` + square + `,[[[20,20],[30,20],[30,30],[20,20]]]]}`,
+		`{"type":"Feature","properties":{},"geometry":{"type":"Polygon","coordinates":` + square + `}}`,
+	}
+	for _, s := range valid {
+		if _, err := parseGeoJSON([]byte(s)); err != nil {
+			t.Errorf("%s: unexpected error %v", s, err)
+		}
+	}
+
+	invalid := []string{
+		`not json`,
+		`{"type":"Point","coordinates":[0,0]}`,
+		`{"type":"Feature","geometry":null}`,
+		`{"type":"Polygon","coordinates":[]}`,
+		`{"type":"Polygon","coordinates":[[[0,0],[10,0],[0,0]]]}`,
+		`{"type":"Polygon","coordinates":[[[0,0],[10,0],[10,10],[0,10]]]}`,
+		`{"type":"Polygon","coordinates":[[[0,0],[200,0],[10,10],[0,0]]]}`,
+	}
+	for _, s := range invalid {
+		if _, err := parseGeoJSON([]byte(s)); err == nil {
+			t.Errorf("%s: expected error", s)
+		}
+	}
+}
+
+func TestGeoPolygons_ContainsWithHole(t *testing.T) {
+	polygons, err := parseGeoJSON([]byte(`{"type":"Polygon","coordinates":[
+		[[0,0],[10,0],[10,10],[0,10],[0,0]],
+		[[4,4],[6,4],[6,6],[4,6],[4,4]]
+	]}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !polygons.contains(2, 2) {
+		t.Error("expected (2,2) inside")
+	}
+	if polygons.contains(5, 5) {
+		t.Error("expected (5,5) inside the hole")
+	}
+	if polygons.contains(11, 5) {
+		t.Error("expected (11,5) outside")
+	}
+}
+
+// areaTestStations sets up Berlin, Paris and Sydney, Paris without data after 1990
+func areaTestStations(t *testing.T) {
+	berlinLat, berlinLong := 52.52, 13.405
+	parisLat, parisLong := 48.8566, 2.3522
+	sydneyLat, sydneyLong := -33.87, 151.21
+	setupGlobalState(t,
+		[]*Station{
+			{ID: "BERLIN01", Name: "Berlin", Latitude: &berlinLat, Longitude: &berlinLong},
+			{ID: "PARIS001", Name: "Paris", Latitude: &parisLat, Longitude: &parisLong},
+			{ID: "SYDNEY01", Name: "Sydney", Latitude: &sydneyLat, Longitude: &sydneyLong},
+		},
+		map[string]*StationInventory{
+			"BERLIN01": temperatureInventory(1900, 2023),
+			"PARIS001": temperatureInventory(1900, 1990),
+			"SYDNEY01": temperatureInventory(1900, 2023),
+		},
+	)
+}
+
+func TestFindStationsInArea(t *testing.T) {
+	areaTestStations(t)
+	europe := boundingBox{MinLon: -10, MinLat: 35, MaxLon: 30, MaxLat: 60}
+
+	stations, _ := findStationsInArea(europe, 0, stationFilter{StartYear: 1950, EndYear: 1980})
+	if len(stations) != 2 || stations[0].ID != "BERLIN01" || stations[1].ID != "PARIS001" {
+		t.Errorf("expected Berlin and Paris, got %v", stations)
+	}
+
+	stations, _ = findStationsInArea(europe, 0, stationFilter{StartYear: 1950, EndYear: 2020})
+	if len(stations) != 1 || stations[0].ID != "BERLIN01" {
+		t.Errorf("expected only Berlin with data until 2020, got %v", stations)
+	}
+
+	stations, _ = findStationsInArea(europe, 1, stationFilter{StartYear: 1950, EndYear: 1980})
+	if len(stations) != 1 {
+		t.Errorf("expected limit 1 to apply, got %d", len(stations))
+	}
+
+	if n := countStationsInArea(europe, stationFilter{}); n != 2 {
+		t.Errorf("expected 2 stations in Europe, got %d", n)
+	}
+}
+
+func TestStationsHandler_BBox(t *testing.T) {
+	areaTestStations(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/stations?bbox=140,-40,160,-30&start=1950&end=2020", nil)
+	rec := httptest.NewRecorder()
+	stationsHandler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var resp struct {
+		Data     []*Station `json:"data"`
+		ErrorMsg string     `json:"errorMessage"`
+	}
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if len(resp.Data) != 1 || resp.Data[0].ID != "SYDNEY01" {
+		t.Errorf("expected Sydney, got %v", resp.Data)
+	}
+
+	// Paris only has data until 1990
+	req = httptest.NewRequest(http.MethodGet, "/stations?bbox=0,45,5,50&start=1950&end=2020", nil)
+	rec = httptest.NewRecorder()
+	stationsHandler(rec, req)
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if !strings.Contains(resp.ErrorMsg, "There are 1 stations in this area") {
+		t.Errorf("unexpected error message %q", resp.ErrorMsg)
+	}
+
+	for _, query := range []string{"?bbox=1,2,3&start=1950&end=2020", "?bbox=0,45,5,50&end=2020", "?bbox=0,45,5,50&start=1950&end=2020&limit=-1"} {
+		req := httptest.NewRequest(http.MethodGet, "/stations"+query, nil)
+		rec := httptest.NewRecorder()
+		stationsHandler(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%q: expected 400, got %d", query, rec.Code)
+		}
+	}
+}
+
+func TestStationsHandler_PostPolygon(t *testing.T) {
+	areaTestStations(t)
+
+	// quadrilateral around Berlin and Paris
+	body := `{"type":"Polygon","coordinates":[[[-5,45],[20,45],[20,60],[-5,55],[-5,45]]]}`
+	req := httptest.NewRequest(http.MethodPost, "/stations?start=1950&end=1980", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	stationsHandler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var resp struct {
+		Data     []*Station `json:"data"`
+		ErrorMsg string     `json:"errorMessage"`
+	}
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if len(resp.Data) != 2 {
+		t.Errorf("expected Berlin and Paris, got %v", resp.Data)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/stations?start=1950&end=1980", strings.NewReader(`{"type":"Point","coordinates":[0,0]}`))
+	rec = httptest.NewRecorder()
+	stationsHandler(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a Point, got %d", rec.Code)
+	}
+}
+
+func TestStationsHandler_Preflight(t *testing.T) {
+	req := httptest.NewRequest(http.MethodOptions, "/stations", nil)
+	rec := httptest.NewRecorder()
+	stationsHandler(rec, req)
+
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", rec.Code)
+	}
+	if !strings.Contains(rec.Header().Get("Access-Control-Allow-Methods"), "POST") {
+		t.Errorf("expected POST to be allowed, got %q", rec.Header().Get("Access-Control-Allow-Methods"))
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/stations", nil)
+	rec = httptest.NewRecorder()
+	stationsHandler(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %d", rec.Code)
+	}
+}
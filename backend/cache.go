@@ -0,0 +1,302 @@
+package main
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCacheMaxEntries = 500
+	defaultCacheMaxBytes   = 512 << 20
+	cacheSweepInterval     = 10 * time.Minute
+)
+
+type cacheEntry struct {
+	id        string
+	data      *stationData
+	version   stationVersion
+	fetchedAt time.Time
+	// estimated memory of data
+	size int64
+	// a background revalidation is running
+	revalidating bool
+}
+
+// stationCache keeps recently used station data in memory. Entries are stale
+// after cacheTTL and still served for cacheStaleTTL while they are
+// revalidated, then they expire. Beyond maxEntries or maxBytes
+// (0 = unlimited) the least recently used entries are evicted.
+type stationCache struct {
+	mu         sync.Mutex
+	entries    map[string]*list.Element
+	lru        *list.List // front is the most recently used *cacheEntry
+	maxEntries int
+	maxBytes   int64
+	bytes      int64
+
+	hits        uint64
+	staleHits   uint64
+	misses      uint64
+	evictions   uint64
+	expirations uint64
+	notModified uint64
+}
+
+// CacheStats are the counters of the memory cache and the size of the disk cache
+type CacheStats struct {
+	Entries    int    `json:"entries"`
+	Bytes      int64  `json:"bytes"`
+	MaxEntries int    `json:"maxEntries"`
+	MaxBytes   int64  `json:"maxBytes"`
+	Hits       uint64 `json:"hits"`
+	// hits served from stale entries
+	StaleHits   uint64 `json:"staleHits"`
+	Misses      uint64 `json:"misses"`
+	Evictions   uint64 `json:"evictions"`
+	Expirations uint64 `json:"expirations"`
+	// revalidations answered with 304 Not Modified
+	NotModified uint64 `json:"notModified"`
+	// requests that waited for a download already in progress
+	Coalesced uint64          `json:"coalesced"`
+	Disk      *DiskCacheStats `json:"disk,omitempty"`
+}
+
+type DiskCacheStats struct {
+	Entries  int   `json:"entries"`
+	Bytes    int64 `json:"bytes"`
+	MaxBytes int64 `json:"maxBytes"`
+}
+
+var cache = newStationCache(defaultCacheMaxEntries, defaultCacheMaxBytes)
+
+func newStationCache(maxEntries int, maxBytes int64) *stationCache {
+	return &stationCache{
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+	}
+}
+
+// newStationCacheFromEnv reads METEO_CACHE_MAX_ENTRIES and
+// METEO_CACHE_MAX_MEMORY_MB, 0 disables a limit.
+func newStationCacheFromEnv() (*stationCache, error) {
+	maxEntries := defaultCacheMaxEntries
+	if s := os.Getenv("METEO_CACHE_MAX_ENTRIES"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("ungültige METEO_CACHE_MAX_ENTRIES %q", s)
+		}
+		maxEntries = n
+	}
+	maxBytes := int64(defaultCacheMaxBytes)
+	if s := os.Getenv("METEO_CACHE_MAX_MEMORY_MB"); s != "" {
+		mb, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || mb < 0 {
+			return nil, fmt.Errorf("ungültige METEO_CACHE_MAX_MEMORY_MB %q", s)
+		}
+		maxBytes = mb << 20
+	}
+	return newStationCache(maxEntries, maxBytes), nil
+}
+
+func (e *cacheEntry) stale() bool {
+	return time.Since(e.fetchedAt) >= cacheTTL
+}
+
+func (e *cacheEntry) expired() bool {
+	return time.Since(e.fetchedAt) >= cacheTTL+cacheStaleTTL
+}
+
+// peek returns the data of the station if it is cached and not expired,
+// without counting a hit or miss
+func (c *stationCache) peek(id string) (*stationData, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[id]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*cacheEntry)
+	if entry.expired() {
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	return entry.data, true
+}
+
+// get returns the data of the station if it is cached and not expired,
+// stale data included
+func (c *stationCache) get(id string) (*stationData, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[id]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	entry := el.Value.(*cacheEntry)
+	if entry.expired() {
+		c.remove(el)
+		c.expirations++
+		c.misses++
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	c.hits++
+	if entry.stale() {
+		c.staleHits++
+	}
+	return entry.data, true
+}
+
+// claimRevalidation marks a stale entry as being revalidated and returns its
+// data and version. It returns false if the entry is fresh, missing or
+// already being revalidated.
+func (c *stationCache) claimRevalidation(id string) (*stationData, stationVersion, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[id]
+	if !ok {
+		return nil, stationVersion{}, false
+	}
+	entry := el.Value.(*cacheEntry)
+	if !entry.stale() || entry.expired() || entry.revalidating {
+		return nil, stationVersion{}, false
+	}
+	entry.revalidating = true
+	return entry.data, entry.version, true
+}
+
+// refresh makes the entry fresh again after the source reported it unchanged
+func (c *stationCache) refresh(id string, fetchedAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.notModified++
+	if el, ok := c.entries[id]; ok {
+		entry := el.Value.(*cacheEntry)
+		entry.fetchedAt = fetchedAt
+		entry.revalidating = false
+	}
+}
+
+// endRevalidation allows the next request to retry a failed revalidation
+func (c *stationCache) endRevalidation(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[id]; ok {
+		el.Value.(*cacheEntry).revalidating = false
+	}
+}
+
+// put stores the data and evicts the least recently used entries if the
+// cache is over its limits
+func (c *stationCache) put(id string, data *stationData, version stationVersion, fetchedAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[id]; ok {
+		c.remove(el)
+	}
+	entry := &cacheEntry{id: id, data: data, version: version, fetchedAt: fetchedAt, size: data.size()}
+	c.entries[id] = c.lru.PushFront(entry)
+	c.bytes += entry.size
+
+	for c.lru.Len() > 1 && ((c.maxEntries > 0 && c.lru.Len() > c.maxEntries) || (c.maxBytes > 0 && c.bytes > c.maxBytes)) {
+		c.remove(c.lru.Back())
+		c.evictions++
+	}
+}
+
+// remove drops an entry, c.mu must be held
+func (c *stationCache) remove(el *list.Element) {
+	entry := c.lru.Remove(el).(*cacheEntry)
+	delete(c.entries, entry.id)
+	c.bytes -= entry.size
+}
+
+// sweep removes all expired entries and returns how many
+func (c *stationCache) sweep() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := 0
+	for el := c.lru.Front(); el != nil; {
+		next := el.Next()
+		if el.Value.(*cacheEntry).expired() {
+			c.remove(el)
+			c.expirations++
+			removed++
+		}
+		el = next
+	}
+	return removed
+}
+
+// startSweeper sweeps the cache every interval until stop is called
+func (c *stationCache) startSweeper(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.sweep()
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+func (c *stationCache) stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{
+		Entries:     c.lru.Len(),
+		Bytes:       c.bytes,
+		MaxEntries:  c.maxEntries,
+		MaxBytes:    c.maxBytes,
+		Hits:        c.hits,
+		StaleHits:   c.staleHits,
+		Misses:      c.misses,
+		Evictions:   c.evictions,
+		Expirations: c.expirations,
+		NotModified: c.notModified,
+	}
+}
+
+func (c *diskCache) stats() *DiskCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return &DiskCacheStats{Entries: len(c.entries), Bytes: c.total, MaxBytes: c.maxBytes}
+}
+
+func cacheStatsHandler(w http.ResponseWriter, r *http.Request) {
+	//cors handling
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+	stats := cache.stats()
+	stats.Coalesced = fetches.coalescedCount()
+	if disk != nil {
+		stats.Disk = disk.stats()
+	}
+	enc := json.NewEncoder(w)
+	response := Response{Data: stats, ErrorMsg: ""}
+	enc.Encode(response)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// cacheTestData returns n daily TMIN values
+func cacheTestData(n int) *stationData {
+	rows := make([]RawStationData, n)
+	for i := range rows {
+		rows[i] = RawStationData{Date: time.Date(2020, 1, 1+i, 0, 0, 0, 0, time.UTC), ElementType: "TMIN"}
+	}
+	return newStationData(rows)
+}
+
+func TestStationCache_LRUByEntries(t *testing.T) {
+	c := newStationCache(2, 0)
+	c.put("A", cacheTestData(1), stationVersion{}, time.Now())
+	c.put("B", cacheTestData(1), stationVersion{}, time.Now())
+	c.get("A") // B is now the least recently used entry
+	c.put("C", cacheTestData(1), stationVersion{}, time.Now())
+
+	if _, ok := c.get("B"); ok {
+		t.Error("expected B to be evicted")
+	}
+	for _, id := range []string{"A", "C"} {
+		if _, ok := c.get(id); !ok {
+			t.Errorf("expected %s to be cached", id)
+		}
+	}
+	stats := c.stats()
+	if stats.Entries != 2 || stats.Evictions != 1 || stats.Hits != 3 || stats.Misses != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestStationCache_LRUByBytes(t *testing.T) {
+	size := cacheTestData(100).size()
+	c := newStationCache(0, 2*size)
+	c.put("A", cacheTestData(100), stationVersion{}, time.Now())
+	c.put("B", cacheTestData(100), stationVersion{}, time.Now())
+	if c.stats().Bytes != 2*size {
+		t.Errorf("expected %d bytes, got %d", 2*size, c.stats().Bytes)
+	}
+	c.put("C", cacheTestData(100), stationVersion{}, time.Now())
+	if _, ok := c.get("A"); ok {
+		t.Error("expected A to be evicted")
+	}
+
+	// an entry larger than the budget is still kept on its own
+	c.put("HUGE", cacheTestData(1000), stationVersion{}, time.Now())
+	if _, ok := c.get("HUGE"); !ok || c.stats().Entries != 1 {
+		t.Errorf("expected only HUGE to be cached, got %+v", c.stats())
+	}
+
+	// replacing an entry does not count its old size twice
+	c.put("HUGE", cacheTestData(10), stationVersion{}, time.Now())
+	if c.stats().Bytes != cacheTestData(10).size() {
+		t.Errorf("unexpected bytes after replacing %d", c.stats().Bytes)
+	}
+}
+
+func TestStationCache_ExpiryAndSweep(t *testing.T) {
+	c := newStationCache(0, 0)
+	c.put("OLD", cacheTestData(1), stationVersion{}, time.Now().Add(-2*cacheTTL-cacheStaleTTL))
+	c.put("OLDER", cacheTestData(1), stationVersion{}, time.Now().Add(-3*cacheTTL-cacheStaleTTL))
+	c.put("NEW", cacheTestData(1), stationVersion{}, time.Now())
+
+	if _, ok := c.get("OLD"); ok {
+		t.Error("expected OLD to be expired")
+	}
+	if n := c.sweep(); n != 1 {
+		t.Errorf("expected 1 swept entry, got %d", n)
+	}
+	stats := c.stats()
+	if stats.Entries != 1 || stats.Expirations != 2 || stats.Bytes != cacheTestData(1).size() {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestStationCache_Sweeper(t *testing.T) {
+	c := newStationCache(0, 0)
+	c.put("OLD", cacheTestData(1), stationVersion{}, time.Now().Add(-2*cacheTTL-cacheStaleTTL))
+
+	stop := c.startSweeper(time.Millisecond)
+	defer stop()
+	deadline := time.Now().Add(time.Second)
+	for c.stats().Entries > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if c.stats().Entries != 0 {
+		t.Error("expected the sweeper to remove the expired entry")
+	}
+	stop()
+	stop() // stopping twice is fine
+}
+
+func TestStationCache_StaleRevalidation(t *testing.T) {
+	c := newStationCache(0, 0)
+	version := stationVersion{ETag: `"v1"`}
+	c.put("STALE", cacheTestData(3), version, time.Now().Add(-2*cacheTTL))
+	c.put("FRESH", cacheTestData(1), version, time.Now())
+
+	// stale entries are still served
+	if data, ok := c.get("STALE"); !ok || data.len() != 3 {
+		t.Fatalf("expected stale data, got %v %v", data, ok)
+	}
+	if _, _, ok := c.claimRevalidation("FRESH"); ok {
+		t.Error("expected no revalidation of a fresh entry")
+	}
+	data, got, ok := c.claimRevalidation("STALE")
+	if !ok || got != version || data.len() != 3 {
+		t.Fatalf("expected to claim the revalidation, got %v %+v", ok, got)
+	}
+	if _, _, ok := c.claimRevalidation("STALE"); ok {
+		t.Error("expected only one revalidation at a time")
+	}
+
+	// a failed revalidation can be retried
+	c.endRevalidation("STALE")
+	if _, _, ok := c.claimRevalidation("STALE"); !ok {
+		t.Error("expected a retry after a failed revalidation")
+	}
+
+	// a 304 makes the entry fresh again
+	c.refresh("STALE", time.Now())
+	if _, _, ok := c.claimRevalidation("STALE"); ok {
+		t.Error("expected the refreshed entry to be fresh")
+	}
+	stats := c.stats()
+	if stats.Hits != 1 || stats.StaleHits != 1 || stats.NotModified != 1 || stats.Expirations != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestCacheStatsHandler(t *testing.T) {
+	setupCache(t)
+	setupDiskCache(t, time.Hour, 1<<20)
+	cache.put("STN001", cacheTestData(10), stationVersion{}, time.Now())
+	cache.get("STN001")
+	cache.get("MISSING")
+
+	req := httptest.NewRequest(http.MethodGet, "/cache/stats", nil)
+	rec := httptest.NewRecorder()
+	cacheStatsHandler(rec, req)
+
+	var resp struct {
+		Data CacheStats `json:"data"`
+	}
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if resp.Data.Entries != 1 || resp.Data.Hits != 1 || resp.Data.Misses != 1 || resp.Data.Bytes != cacheTestData(10).size() {
+		t.Errorf("unexpected stats %+v", resp.Data)
+	}
+	if resp.Data.Disk == nil || resp.Data.Disk.MaxBytes != 1<<20 {
+		t.Errorf("expected disk stats, got %+v", resp.Data.Disk)
+	}
+}
+
+func TestNewStationCacheFromEnv(t *testing.T) {
+	t.Setenv("METEO_CACHE_MAX_ENTRIES", "")
+	t.Setenv("METEO_CACHE_MAX_MEMORY_MB", "")
+	c, err := newStationCacheFromEnv()
+	if err != nil || c.maxEntries != defaultCacheMaxEntries || c.maxBytes != defaultCacheMaxBytes {
+		t.Errorf("expected defaults, got %+v %v", c, err)
+	}
+
+	t.Setenv("METEO_CACHE_MAX_ENTRIES", "0")
+	t.Setenv("METEO_CACHE_MAX_MEMORY_MB", "64")
+	c, err = newStationCacheFromEnv()
+	if err != nil || c.maxEntries != 0 || c.maxBytes != 64<<20 {
+		t.Errorf("unexpected cache %+v %v", c, err)
+	}
+
+	t.Setenv("METEO_CACHE_MAX_ENTRIES", "many")
+	if _, err := newStationCacheFromEnv(); err == nil {
+		t.Error("expected error for an invalid entry count")
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	fetchAttempts   = 3
+	fetchBackoff    = 250 * time.Millisecond
+	fetchMaxBackoff = 5 * time.Second
+	// consecutive failed requests that open the circuit
+	breakerThreshold = 5
+	breakerCooldown  = 30 * time.Second
+)
+
+// errSourceUnavailable is returned without a request while the circuit is open
+var errSourceUnavailable = errors.New("Datenquelle nicht erreichbar, bitte später erneut versuchen")
+
+// fetchClient is the HTTP client for all downloads. Network errors and 5xx
+// responses are retried with jittered exponential backoff; after
+// breakerThreshold failed requests the circuit breaker rejects requests for
+// breakerCooldown so callers fail fast while the source is down.
+type fetchClient struct {
+	client     *http.Client
+	attempts   int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	breaker    *circuitBreaker
+}
+
+// shared client of the httpSource
+var httpClient = newFetchClient()
+
+func newFetchClient() *fetchClient {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+	transport.TLSHandshakeTimeout = 10 * time.Second
+	transport.ResponseHeaderTimeout = 30 * time.Second
+	return &fetchClient{
+		// the overall timeout includes reading large station files
+		client:     &http.Client{Transport: transport, Timeout: 5 * time.Minute},
+		attempts:   fetchAttempts,
+		backoff:    fetchBackoff,
+		maxBackoff: fetchMaxBackoff,
+		breaker:    &circuitBreaker{threshold: breakerThreshold, cooldown: breakerCooldown},
+	}
+}
+
+// retryable reports whether a response status is worth another attempt
+func retryable(status int) bool {
+	return status >= 500 || status == http.StatusTooManyRequests
+}
+
+// wait returns a random backoff between 0 and backoff*2^attempt
+func (c *fetchClient) wait(attempt int) time.Duration {
+	limit := min(c.backoff<<attempt, c.maxBackoff)
+	if limit <= 0 {
+		return 0
+	}
+	return rand.N(limit)
+}
+
+// do sends a GET request without body. The last 5xx response is returned to
+// the caller if all attempts fail.
+func (c *fetchClient) do(req *http.Request) (*http.Response, error) {
+	if !c.breaker.allow() {
+		return nil, errSourceUnavailable
+	}
+
+	var resp *http.Response
+	var err error
+	for attempt := 0; ; attempt++ {
+		resp, err = c.client.Do(req)
+		if err == nil && !retryable(resp.StatusCode) {
+			c.breaker.success()
+			return resp, nil
+		}
+		if attempt+1 >= c.attempts {
+			break
+		}
+		if err == nil {
+			//draining the body lets the connection be reused
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		time.Sleep(c.wait(attempt))
+	}
+	c.breaker.failure()
+	return resp, err
+}
+
+// get is do for a plain GET of url
+func (c *fetchClient) get(url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(req)
+}
+
+// circuitBreaker counts consecutive failures. Once open it lets a single
+// probe through after the cooldown, which closes it on success or opens it
+// again on failure.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time // zero while closed
+	probing  bool
+}
+
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.openedAt.IsZero() {
+		return true
+	}
+	if b.probing || time.Since(b.openedAt) < b.cooldown {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.openedAt = time.Time{}
+	b.probing = false
+}
+
+func (b *circuitBreaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.probing || b.failures >= b.threshold {
+		b.openedAt = time.Now()
+		b.probing = false
+	}
+}
+
+// fetchErrorStatus is the HTTP status for a failed station download
+func fetchErrorStatus(err error) int {
+	if errors.Is(err, errSourceUnavailable) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
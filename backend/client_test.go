@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// setupFetchClient replaces the shared client with one that retries without
+// waiting. Cleans up after test completes.
+func setupFetchClient(t *testing.T, threshold int, cooldown time.Duration) *fetchClient {
+	old := httpClient
+	httpClient = newFetchClient()
+	httpClient.backoff = time.Millisecond
+	httpClient.breaker = &circuitBreaker{threshold: threshold, cooldown: cooldown}
+	t.Cleanup(func() {
+		httpClient = old
+	})
+	return httpClient
+}
+
+// failingServer answers the first failures requests with status and then 200
+func failingServer(failures int32, status int) (*httptest.Server, *int32) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) <= failures {
+			w.WriteHeader(status)
+			return
+		}
+		w.Write([]byte("OK"))
+	}))
+	return server, &requests
+}
+
+func TestFetchClient_RetriesServerErrors(t *testing.T) {
+	c := setupFetchClient(t, 5, time.Minute)
+	server, requests := failingServer(2, http.StatusServiceUnavailable)
+	defer server.Close()
+
+	resp, err := c.get(server.URL)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected success after retries, got %v %v", resp, err)
+	}
+	resp.Body.Close()
+	if *requests != 3 {
+		t.Errorf("expected 3 requests, got %d", *requests)
+	}
+	if c.breaker.failures != 0 {
+		t.Errorf("expected no counted failure, got %d", c.breaker.failures)
+	}
+}
+
+func TestFetchClient_NoRetryOnNotFound(t *testing.T) {
+	c := setupFetchClient(t, 5, time.Minute)
+	server, requests := failingServer(10, http.StatusNotFound)
+	defer server.Close()
+
+	resp, err := c.get(server.URL)
+	if err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404, got %v %v", resp, err)
+	}
+	resp.Body.Close()
+	if *requests != 1 {
+		t.Errorf("expected 1 request, got %d", *requests)
+	}
+}
+
+func TestFetchClient_GivesUp(t *testing.T) {
+	c := setupFetchClient(t, 5, time.Minute)
+	server, requests := failingServer(10, http.StatusInternalServerError)
+	defer server.Close()
+
+	resp, err := c.get(server.URL)
+	if err != nil || resp.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("expected the last 500 response, got %v %v", resp, err)
+	}
+	resp.Body.Close()
+	if *requests != fetchAttempts {
+		t.Errorf("expected %d requests, got %d", fetchAttempts, *requests)
+	}
+
+	if _, err := c.get("http://127.0.0.1:1"); err == nil {
+		t.Error("expected a network error")
+	}
+	if c.breaker.failures != 2 {
+		t.Errorf("expected 2 failures, got %d", c.breaker.failures)
+	}
+}
+
+func TestFetchClient_CircuitBreaker(t *testing.T) {
+	c := setupFetchClient(t, 2, 50*time.Millisecond)
+	server, requests := failingServer(3*fetchAttempts, http.StatusBadGateway)
+	defer server.Close()
+
+	for i := 0; i < 2; i++ {
+		resp, err := c.get(server.URL)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	// the open circuit fails without a request
+	if _, err := c.get(server.URL); !errors.Is(err, errSourceUnavailable) {
+		t.Fatalf("expected errSourceUnavailable, got %v", err)
+	}
+	if *requests != 2*fetchAttempts {
+		t.Errorf("expected %d requests, got %d", 2*fetchAttempts, *requests)
+	}
+
+	// after the cooldown a failed probe opens the circuit again
+	time.Sleep(60 * time.Millisecond)
+	resp, err := c.get(server.URL)
+	if err != nil {
+		t.Fatalf("expected a probe, got %v", err)
+	}
+	resp.Body.Close()
+	if _, err := c.get(server.URL); !errors.Is(err, errSourceUnavailable) {
+		t.Errorf("expected the circuit to be open after a failed probe, got %v", err)
+	}
+
+	// a successful probe closes it
+	time.Sleep(60 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		resp, err := c.get(server.URL)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected success, got %v %v", resp, err)
+		}
+		resp.Body.Close()
+	}
+}
+
+func TestCircuitBreaker_SingleProbe(t *testing.T) {
+	b := &circuitBreaker{threshold: 1, cooldown: 0}
+	b.failure()
+	if !b.allow() {
+		t.Fatal("expected a probe after the cooldown")
+	}
+	if b.allow() {
+		t.Error("expected only one probe at a time")
+	}
+	b.success()
+	if !b.allow() || !b.allow() {
+		t.Error("expected a closed circuit after a successful probe")
+	}
+}
+
+func TestStationHandler_SourceUnavailable(t *testing.T) {
+	setupCache(t)
+	c := setupFetchClient(t, 1, time.Minute)
+	setupSource(t, &httpSource{baseURL: "http://127.0.0.1:1"})
+
+	// the first request opens the circuit, the second fails fast
+	for i, want := range []int{http.StatusInternalServerError, http.StatusServiceUnavailable} {
+		req := httptest.NewRequest(http.MethodGet, "/station?id=STN001", nil)
+		rec := httptest.NewRecorder()
+		stationHandler(rec, req)
+		if rec.Code != want {
+			t.Errorf("request %d: expected status %d, got %d", i, want, rec.Code)
+		}
+	}
+	if c.breaker.failures != 1 {
+		t.Errorf("expected 1 failure, got %d", c.breaker.failures)
+	}
+}
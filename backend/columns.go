@@ -0,0 +1,195 @@
+package main
+
+import (
+	"slices"
+	"time"
+	"unsafe"
+)
+
+// stationData holds the observations of a station in columns, one series per
+// supported element (same order as supportedElements). An observation costs
+// 6 bytes plus its share of the flag runs instead of a RawStationData of
+// 56 bytes, so the cache holds many more stations in the same memory.
+type stationData struct {
+	series []elementSeries
+}
+
+// elementSeries are the observations of one element sorted by day.
+// Duplicate days keep their order of the source file.
+type elementSeries struct {
+	days   []int32 // days since 1970-01-01
+	values []int16 // raw GHCN units
+	flags  []flagRun
+}
+
+// flagRun holds the M/Q/S flags of the observations from start up to the
+// start of the next run. Flags rarely change between consecutive days, so a
+// series needs few runs.
+type flagRun struct {
+	start   int32
+	m, q, s byte
+}
+
+// dayOf returns the days since 1970-01-01 of a UTC date
+func dayOf(t time.Time) int32 {
+	sec := t.Unix()
+	day := sec / 86400
+	if sec%86400 < 0 {
+		day--
+	}
+	return int32(day)
+}
+
+// dateOf returns midnight UTC of the day
+func dateOf(day int32) time.Time {
+	return time.Unix(int64(day)*86400, 0).UTC()
+}
+
+// civilDate returns the calendar date of the day, the inverse of daysSinceEpoch
+func civilDate(day int32) (year int, month time.Month, dom int) {
+	z := int(day) + 719468
+	era := z / 146097
+	if z < 0 {
+		era = (z - 146096) / 146097
+	}
+	dayOfEra := z - era*146097
+	yearOfEra := (dayOfEra - dayOfEra/1460 + dayOfEra/36524 - dayOfEra/146096) / 365
+	dayOfYear := dayOfEra - (365*yearOfEra + yearOfEra/4 - yearOfEra/100)
+	mp := (5*dayOfYear + 2) / 153
+	dom = dayOfYear - (153*mp+2)/5 + 1
+	m := mp + 3
+	if m > 12 {
+		m -= 12
+	}
+	year = yearOfEra + era*400
+	if m <= 2 {
+		year++
+	}
+	return year, time.Month(m), dom
+}
+
+func (e *elementSeries) len() int {
+	return len(e.days)
+}
+
+// runEnd returns the index after the last observation of flag run r
+func (e *elementSeries) runEnd(r int) int {
+	if r+1 < len(e.flags) {
+		return int(e.flags[r+1].start)
+	}
+	return len(e.days)
+}
+
+// len returns the number of observations of all elements
+func (d *stationData) len() int {
+	n := 0
+	for i := range d.series {
+		n += d.series[i].len()
+	}
+	return n
+}
+
+// size estimates the memory held by the columns
+func (d *stationData) size() int64 {
+	size := int64(unsafe.Sizeof(stationData{})) + int64(cap(d.series))*int64(unsafe.Sizeof(elementSeries{}))
+	for _, e := range d.series {
+		size += int64(cap(e.days))*4 + int64(cap(e.values))*2 + int64(cap(e.flags))*int64(unsafe.Sizeof(flagRun{}))
+	}
+	return size
+}
+
+// element returns the series of the element, empty for unknown elements
+func (d *stationData) element(element string) *elementSeries {
+	i := slices.Index(supportedElements, element)
+	if i < 0 || i >= len(d.series) {
+		return &elementSeries{}
+	}
+	return &d.series[i]
+}
+
+// filter returns the data with the observations whose flags pass keep.
+// d itself is returned if nothing has to be removed.
+func (d *stationData) filter(keep func(r flagRun) bool) *stationData {
+	if !slices.ContainsFunc(d.series, func(e elementSeries) bool {
+		return slices.ContainsFunc(e.flags, func(r flagRun) bool { return !keep(r) })
+	}) {
+		return d
+	}
+
+	filtered := &stationData{series: make([]elementSeries, len(d.series))}
+	for i, e := range d.series {
+		var out elementSeries
+		for r, run := range e.flags {
+			if !keep(run) {
+				continue
+			}
+			start, end := int(run.start), e.runEnd(r)
+			run.start = int32(len(out.days))
+			out.flags = append(out.flags, run)
+			out.days = append(out.days, e.days[start:end]...)
+			out.values = append(out.values, e.values[start:end]...)
+		}
+		filtered.series[i] = out
+	}
+	return filtered
+}
+
+// stationDataBuilder collects observations in any order
+type stationDataBuilder struct {
+	series []seriesBuilder
+}
+
+type seriesBuilder struct {
+	days     []int32
+	values   []int16
+	flags    [][3]byte
+	unsorted bool
+}
+
+func (b *stationDataBuilder) add(element int, day int32, value int16, m, q, s byte) {
+	if b.series == nil {
+		b.series = make([]seriesBuilder, len(supportedElements))
+	}
+	sb := &b.series[element]
+	if n := len(sb.days); n > 0 && day < sb.days[n-1] {
+		sb.unsorted = true
+	}
+	sb.days = append(sb.days, day)
+	sb.values = append(sb.values, value)
+	sb.flags = append(sb.flags, [3]byte{m, q, s})
+}
+
+// data sorts the series by day and stores them with exactly sized columns
+func (b *stationDataBuilder) data() *stationData {
+	d := &stationData{series: make([]elementSeries, len(supportedElements))}
+	for i := range b.series {
+		sb := &b.series[i]
+		var order []int
+		if sb.unsorted {
+			order = make([]int, len(sb.days))
+			for j := range order {
+				order[j] = j
+			}
+			slices.SortStableFunc(order, func(x, y int) int { return int(sb.days[x]) - int(sb.days[y]) })
+		}
+
+		e := elementSeries{days: make([]int32, len(sb.days)), values: make([]int16, len(sb.days))}
+		var runs []flagRun
+		for j := range sb.days {
+			k := j
+			if order != nil {
+				k = order[j]
+			}
+			e.days[j] = sb.days[k]
+			e.values[j] = sb.values[k]
+			f := sb.flags[k]
+			if n := len(runs); n == 0 || runs[n-1].m != f[0] || runs[n-1].q != f[1] || runs[n-1].s != f[2] {
+				runs = append(runs, flagRun{start: int32(j), m: f[0], q: f[1], s: f[2]})
+			}
+		}
+		e.flags = make([]flagRun, len(runs))
+		copy(e.flags, runs)
+		d.series[i] = e
+	}
+	return d
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+func TestCivilDate(t *testing.T) {
+	for day := time.Date(1599, 1, 1, 0, 0, 0, 0, time.UTC); day.Year() < 2101; day = day.AddDate(0, 0, 1) {
+		d := dayOf(day)
+		if int64(d) != daysSinceEpoch(day.Year(), int(day.Month()), day.Day()) {
+			t.Fatalf("%s: dayOf %d does not match daysSinceEpoch", day.Format("20060102"), d)
+		}
+		year, month, dom := civilDate(d)
+		if year != day.Year() || month != day.Month() || dom != day.Day() {
+			t.Fatalf("%s: got %d-%d-%d", day.Format("20060102"), year, month, dom)
+		}
+		if !dateOf(d).Equal(day) {
+			t.Fatalf("%s: dateOf returned %v", day.Format("20060102"), dateOf(d))
+		}
+	}
+	// times within a day before 1970 still belong to that day
+	if d := dayOf(time.Date(1969, 12, 31, 12, 0, 0, 0, time.UTC)); d != -1 {
+		t.Errorf("expected day -1, got %d", d)
+	}
+}
+
+func TestNewStationData(t *testing.T) {
+	day := func(dom int) time.Time { return time.Date(2020, 1, dom, 0, 0, 0, 0, time.UTC) }
+	data := newStationData([]RawStationData{
+		{Date: day(3), ElementType: "TMIN", Value: 30},
+		{Date: day(1), ElementType: "TMIN", Value: 10, QFlag: 'D'},
+		{Date: day(3), ElementType: "TMIN", Value: 31},
+		{Date: day(2), ElementType: "TAVG", Value: 5},
+		{Date: day(2), ElementType: "PRCP", Value: 40000},
+		{Date: day(2), ElementType: "PRCP", Value: 7},
+	})
+
+	tmin := data.element("TMIN")
+	if !slices.Equal(tmin.days, []int32{dayOf(day(1)), dayOf(day(3)), dayOf(day(3))}) {
+		t.Errorf("expected the days to be sorted, got %v", tmin.days)
+	}
+	// duplicate days keep the order of the input
+	if !slices.Equal(tmin.values, []int16{10, 30, 31}) {
+		t.Errorf("unexpected values %v", tmin.values)
+	}
+	if len(tmin.flags) != 2 || tmin.flags[0].q != 'D' || tmin.flags[1].start != 1 {
+		t.Errorf("unexpected flag runs %+v", tmin.flags)
+	}
+	// TAVG is not supported and 40000 does not fit into int16
+	if data.len() != 4 || data.element("PRCP").len() != 1 || data.element("TAVG").len() != 0 {
+		t.Errorf("unexpected series %+v", data.series)
+	}
+}
+
+func TestStationData_Filter(t *testing.T) {
+	var rows []RawStationData
+	for i, q := range []byte{0, 0, 'D', 'D', 0, 'G', 0} {
+		rows = append(rows, RawStationData{Date: time.Date(2020, 1, 1+i, 0, 0, 0, 0, time.UTC), ElementType: "TMAX", Value: i, QFlag: q})
+	}
+	data := newStationData(rows)
+	if n := len(data.element("TMAX").flags); n != 5 {
+		t.Fatalf("expected 5 flag runs, got %d", n)
+	}
+
+	unflagged := data.filter(func(r flagRun) bool { return r.q == 0 })
+	tmax := unflagged.element("TMAX")
+	if !slices.Equal(tmax.values, []int16{0, 1, 4, 6}) {
+		t.Errorf("unexpected values %v", tmax.values)
+	}
+	if len(tmax.flags) != 3 || tmax.runEnd(0) != 2 || tmax.runEnd(1) != 3 || tmax.runEnd(2) != 4 {
+		t.Errorf("unexpected flag runs %+v", tmax.flags)
+	}
+	if data.element("TMAX").len() != 7 {
+		t.Error("expected the original data to be unchanged")
+	}
+	if all := data.filter(func(flagRun) bool { return true }); all != data {
+		t.Error("expected the data itself when nothing is removed")
+	}
+}
+
+func TestStationData_Size(t *testing.T) {
+	input := stationCSV(30)
+	rows := parseStationCSVReference(strings.NewReader(input))
+	data, err := parseStationCSV(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if data.len() != len(rows) {
+		t.Fatalf("expected %d observations, got %d", len(rows), data.len())
+	}
+	rowsSize := int64(cap(rows)) * int64(unsafe.Sizeof(RawStationData{}))
+	if ratio := float64(rowsSize) / float64(data.size()); ratio < 10 {
+		t.Errorf("expected the columns to need a tenth of the memory, got %d vs %d bytes", data.size(), rowsSize)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// names of the FIPS country codes and of the US states / Canadian provinces
+var (
+	countryNames = make(map[string]string)
+	stateNames   = make(map[string]string)
+)
+
+// Country is a country with the number of stations in it
+type Country struct {
+	Code     string `json:"code"`
+	Name     string `json:"name"`
+	Stations int    `json:"stations"`
+}
+
+// loading ghcnd-countries.txt and ghcnd-states.txt on start up
+func loadCountries() error {
+	countries, err := loadCodeNames("ghcnd-countries.txt")
+	if err != nil {
+		return err
+	}
+	states, err := loadCodeNames("ghcnd-states.txt")
+	if err != nil {
+		return err
+	}
+	countryNames = countries
+	stateNames = states
+	return nil
+}
+
+func loadCodeNames(name string) (map[string]string, error) {
+	body, err := source.open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return parseCodeNames(body)
+}
+
+// parseCodeNames reads lines of a 2 character code, a space and a name
+// (CODE 1-2, NAME 4-...)
+func parseCodeNames(r io.Reader) (map[string]string, error) {
+	names := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(line) < 4 {
+			continue
+		}
+		code := strings.TrimSpace(line[0:2])
+		name := strings.TrimSpace(line[3:])
+		if code == "" || name == "" {
+			continue
+		}
+		names[code] = name
+	}
+	return names, scanner.Err()
+}
+
+// listCountries returns all countries with stations, sorted by name
+func listCountries() []*Country {
+	byCode := make(map[string]*Country)
+	for _, s := range allStations {
+		c, ok := byCode[s.Country]
+		if !ok {
+			c = &Country{Code: s.Country, Name: countryNames[s.Country]}
+			byCode[s.Country] = c
+		}
+		c.Stations++
+	}
+
+	countries := make([]*Country, 0, len(byCode))
+	for _, c := range byCode {
+		countries = append(countries, c)
+	}
+	slices.SortFunc(countries, func(a, b *Country) int {
+		if c := strings.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Code, b.Code)
+	})
+	return countries
+}
+
+func countriesHandler(w http.ResponseWriter, r *http.Request) {
+	//cors handling
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+	enc := json.NewEncoder(w)
+	response := Response{Data: listCountries(), ErrorMsg: ""}
+	enc.Encode(response)
+}
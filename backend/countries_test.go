@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseCodeNames(t *testing.T) {
+	input := "AC Antigua and Barbuda \nGM Germany\nUS United States\n\nX\n"
+	names, err := parseCodeNames(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(names) != 3 || names["AC"] != "Antigua and Barbuda" || names["GM"] != "Germany" {
+		t.Errorf("unexpected names %v", names)
+	}
+}
+
+// countryTestStations sets up two German stations and one US station
+func countryTestStations(t *testing.T) {
+	oldCountries := countryNames
+	countryNames = map[string]string{"GM": "Germany", "US": "United States"}
+	t.Cleanup(func() { countryNames = oldCountries })
+
+	lat1, long1 := 52.52, 13.405
+	lat2, long2 := 52.6, 13.5
+	lat3, long3 := 52.55, 13.45
+	setupGlobalState(t,
+		[]*Station{
+			{ID: "GM000003319", Country: "GM", Latitude: &lat1, Longitude: &long1},
+			{ID: "GM000004199", Country: "GM", Latitude: &lat2, Longitude: &long2},
+			{ID: "USC00270690", Country: "US", Latitude: &lat3, Longitude: &long3},
+		},
+		map[string]*StationInventory{
+			"GM000003319": temperatureInventory(1900, 2023),
+			"GM000004199": temperatureInventory(1900, 2023),
+			"USC00270690": temperatureInventory(1900, 2023),
+		},
+	)
+}
+
+func TestListCountries(t *testing.T) {
+	countryTestStations(t)
+
+	countries := listCountries()
+	if len(countries) != 2 {
+		t.Fatalf("expected 2 countries, got %d", len(countries))
+	}
+	if *countries[0] != (Country{Code: "GM", Name: "Germany", Stations: 2}) {
+		t.Errorf("unexpected first country %+v", countries[0])
+	}
+	if *countries[1] != (Country{Code: "US", Name: "United States", Stations: 1}) {
+		t.Errorf("unexpected second country %+v", countries[1])
+	}
+}
+
+func TestCountriesHandler(t *testing.T) {
+	countryTestStations(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/countries", nil)
+	rec := httptest.NewRecorder()
+	countriesHandler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var resp struct {
+		Data []*Country `json:"data"`
+	}
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if len(resp.Data) != 2 || resp.Data[0].Name != "Germany" {
+		t.Errorf("unexpected countries %+v", resp.Data)
+	}
+}
+
+func TestFindStations_CountryFilter(t *testing.T) {
+	countryTestStations(t)
+
+	filter, err := parseStationFilter(url.Values{"country": {"us"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	filter.StartYear, filter.EndYear = 1950, 2020
+	result, _ := findStations(52.52, 13.405, 100, 10, filter)
+	if len(result) != 1 || result[0].ID != "USC00270690" {
+		t.Errorf("expected the US station, got %v", result)
+	}
+
+	filter.Countries = []string{"GM", "US"}
+	result, _ = findStations(52.52, 13.405, 100, 10, filter)
+	var ids []string
+	for _, s := range result {
+		ids = append(ids, s.ID)
+	}
+	slices.Sort(ids)
+	if !slices.Equal(ids, []string{"GM000003319", "GM000004199", "USC00270690"}) {
+		t.Errorf("expected all stations, got %v", ids)
+	}
+
+	if _, err := parseStationFilter(url.Values{"country": {"GER"}}); err == nil {
+		t.Error("expected error for a 3 letter country code")
+	}
+}
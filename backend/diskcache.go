@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultDiskCacheTTL   = 24 * time.Hour
+	defaultDiskCacheBytes = 1 << 30
+)
+
+// file layout: magic, version, fetchedAt (unix seconds), series count,
+// ETag and Last-Modified (uint16 length + bytes), the series, CRC32 of
+// everything before it; all little endian. A series is stored like in
+// memory: observation and flag run count (uint32), the days (int32), the
+// values (int16) and the flag runs (uint32 start, M/Q/S flag).
+var diskCacheMagic = [4]byte{'M', 'T', 'C', 'F'}
+
+const diskCacheVersion = 3
+
+// upper bound for the observations of one series, larger counts are corrupt
+const maxSeriesLen = 1 << 24
+
+// diskCache stores parsed station data in dir, one file per station. Entries
+// expire after ttl and the least recently used files are removed when the
+// total size exceeds maxBytes. The file modification time keeps the LRU
+// order across restarts.
+type diskCache struct {
+	dir      string
+	ttl      time.Duration
+	maxBytes int64
+
+	mu      sync.Mutex
+	entries map[string]*diskEntry
+	total   int64
+}
+
+type diskEntry struct {
+	size     int64
+	lastUsed time.Time
+}
+
+// disk cache below the memory cache, nil if disabled
+var disk *diskCache
+
+// newDiskCacheFromEnv enables the disk cache if METEO_CACHE_DIR is set.
+// METEO_CACHE_TTL (e.g. "48h") and METEO_CACHE_MAX_MB override the defaults.
+func newDiskCacheFromEnv() (*diskCache, error) {
+	dir := os.Getenv("METEO_CACHE_DIR")
+	if dir == "" {
+		return nil, nil
+	}
+	ttl := defaultDiskCacheTTL
+	if s := os.Getenv("METEO_CACHE_TTL"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("ungültige METEO_CACHE_TTL %q", s)
+		}
+		ttl = d
+	}
+	maxBytes := int64(defaultDiskCacheBytes)
+	if s := os.Getenv("METEO_CACHE_MAX_MB"); s != "" {
+		mb, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || mb <= 0 {
+			return nil, fmt.Errorf("ungültige METEO_CACHE_MAX_MB %q", s)
+		}
+		maxBytes = mb << 20
+	}
+	return openDiskCache(dir, ttl, maxBytes)
+}
+
+// openDiskCache creates dir if needed and indexes the files already in it
+func openDiskCache(dir string, ttl time.Duration, maxBytes int64) (*diskCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("Cache-Verzeichnis %s nicht anlegbar: %v", dir, err)
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("Cache-Verzeichnis %s nicht lesbar: %v", dir, err)
+	}
+
+	c := &diskCache{dir: dir, ttl: ttl, maxBytes: maxBytes, entries: make(map[string]*diskEntry)}
+	for _, f := range files {
+		id, ok := strings.CutSuffix(f.Name(), ".bin")
+		if !ok || f.IsDir() {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			continue
+		}
+		c.entries[id] = &diskEntry{size: info.Size(), lastUsed: info.ModTime()}
+		c.total += info.Size()
+	}
+	c.mu.Lock()
+	c.evict()
+	c.mu.Unlock()
+	return c, nil
+}
+
+func (c *diskCache) path(id string) string {
+	return filepath.Join(c.dir, id+".bin")
+}
+
+// get returns the cached data of the station, its version and when it was
+// fetched. The file is read without holding c.mu.
+func (c *diskCache) get(id string) (*stationData, stationVersion, time.Time, bool) {
+	if checkStationID(id) != nil {
+		return nil, stationVersion{}, time.Time{}, false
+	}
+	c.mu.Lock()
+	entry, ok := c.entries[id]
+	c.mu.Unlock()
+	if !ok {
+		return nil, stationVersion{}, time.Time{}, false
+	}
+
+	f, err := os.Open(c.path(id))
+	if err != nil {
+		c.removeEntry(id, entry)
+		return nil, stationVersion{}, time.Time{}, false
+	}
+	data, version, fetchedAt, err := decodeStationData(bufio.NewReader(f))
+	f.Close()
+	if err != nil || time.Since(fetchedAt) >= c.ttl {
+		c.removeEntry(id, entry)
+		return nil, stationVersion{}, time.Time{}, false
+	}
+
+	now := time.Now()
+	c.mu.Lock()
+	entry.lastUsed = now
+	c.mu.Unlock()
+	os.Chtimes(c.path(id), now, now)
+	return data, version, fetchedAt, true
+}
+
+// put writes the station data and evicts old entries if the cache is full.
+// The file is written without holding c.mu, only the rename is done under it
+// so the entries always match the files.
+func (c *diskCache) put(id string, data *stationData, version stationVersion, fetchedAt time.Time) error {
+	if err := checkStationID(id); err != nil {
+		return err
+	}
+
+	// write to a temporary file first, so readers never see half a file
+	tmp, err := os.CreateTemp(c.dir, id+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("Cache-Datei nicht anlegbar: %v", err)
+	}
+	w := bufio.NewWriter(tmp)
+	err = encodeStationData(w, data, version, fetchedAt)
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("Cache-Datei %s nicht schreibbar: %v", id, err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := os.Rename(tmp.Name(), c.path(id)); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("Cache-Datei %s nicht schreibbar: %v", id, err)
+	}
+	size := encodedSize(data, version)
+	if old, ok := c.entries[id]; ok {
+		c.total -= old.size
+	}
+	c.entries[id] = &diskEntry{size: size, lastUsed: time.Now()}
+	c.total += size
+	c.evict()
+	return nil
+}
+
+// removeEntry deletes the entry unless a put has replaced it since it was
+// read, so a failed read does not remove the file of a newer put
+func (c *diskCache) removeEntry(id string, entry *diskEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries[id] == entry {
+		c.remove(id)
+	}
+}
+
+// remove deletes an entry, c.mu must be held. The file is removed under the
+// lock so a concurrent put of the same station cannot lose its new file.
+func (c *diskCache) remove(id string) {
+	if entry, ok := c.entries[id]; ok {
+		c.total -= entry.size
+		delete(c.entries, id)
+	}
+	os.Remove(c.path(id))
+}
+
+// evict removes the least recently used entries until the cache fits
+// maxBytes, c.mu must be held
+func (c *diskCache) evict() {
+	if c.total <= c.maxBytes {
+		return
+	}
+	ids := make([]string, 0, len(c.entries))
+	for id := range c.entries {
+		ids = append(ids, id)
+	}
+	slices.SortFunc(ids, func(a, b string) int {
+		return c.entries[a].lastUsed.Compare(c.entries[b].lastUsed)
+	})
+	for _, id := range ids {
+		if c.total <= c.maxBytes {
+			return
+		}
+		c.remove(id)
+	}
+}
+
+var errCorruptCache = errors.New("Cache-Datei beschädigt")
+
+// encodedSize returns the size of the file written by encodeStationData
+func encodedSize(data *stationData, version stationVersion) int64 {
+	size := int64(len(diskCacheMagic) + 2 + 8 + 4 + 2 + len(version.ETag) + 2 + len(version.LastModified) + 4)
+	for _, e := range data.series {
+		size += 8 + int64(e.len())*6 + int64(len(e.flags))*7
+	}
+	return size
+}
+
+func encodeStationData(w io.Writer, data *stationData, version stationVersion, fetchedAt time.Time) error {
+	h := crc32.NewIEEE()
+	out := io.MultiWriter(w, h)
+
+	header := make([]byte, 0, 22+len(version.ETag)+len(version.LastModified))
+	header = append(header, diskCacheMagic[:]...)
+	header = binary.LittleEndian.AppendUint16(header, diskCacheVersion)
+	header = binary.LittleEndian.AppendUint64(header, uint64(fetchedAt.Unix()))
+	header = binary.LittleEndian.AppendUint32(header, uint32(len(data.series)))
+	for _, field := range []string{version.ETag, version.LastModified} {
+		if len(field) > math.MaxUint16 {
+			return fmt.Errorf("Version zu lang: %q", field[:32])
+		}
+		header = binary.LittleEndian.AppendUint16(header, uint16(len(field)))
+		header = append(header, field...)
+	}
+	if _, err := out.Write(header); err != nil {
+		return err
+	}
+
+	for _, e := range data.series {
+		counts := []uint32{uint32(e.len()), uint32(len(e.flags))}
+		runs := make([]byte, 0, len(e.flags)*7)
+		for _, r := range e.flags {
+			runs = binary.LittleEndian.AppendUint32(runs, uint32(r.start))
+			runs = append(runs, r.m, r.q, r.s)
+		}
+		for _, column := range []any{counts, e.days, e.values, runs} {
+			if err := binary.Write(out, binary.LittleEndian, column); err != nil {
+				return err
+			}
+		}
+	}
+	return binary.Write(w, binary.LittleEndian, h.Sum32())
+}
+
+func decodeStationData(r io.Reader) (*stationData, stationVersion, time.Time, error) {
+	h := crc32.NewIEEE()
+	in := io.TeeReader(r, h)
+
+	header := make([]byte, 18)
+	if _, err := io.ReadFull(in, header); err != nil {
+		return nil, stationVersion{}, time.Time{}, errCorruptCache
+	}
+	if [4]byte(header[0:4]) != diskCacheMagic || binary.LittleEndian.Uint16(header[4:6]) != diskCacheVersion {
+		return nil, stationVersion{}, time.Time{}, errCorruptCache
+	}
+	fetchedAt := time.Unix(int64(binary.LittleEndian.Uint64(header[6:14])), 0)
+	if binary.LittleEndian.Uint32(header[14:18]) != uint32(len(supportedElements)) {
+		return nil, stationVersion{}, time.Time{}, errCorruptCache
+	}
+
+	var fields [2]string
+	for i := range fields {
+		var length uint16
+		if err := binary.Read(in, binary.LittleEndian, &length); err != nil {
+			return nil, stationVersion{}, time.Time{}, errCorruptCache
+		}
+		field := make([]byte, length)
+		if _, err := io.ReadFull(in, field); err != nil {
+			return nil, stationVersion{}, time.Time{}, errCorruptCache
+		}
+		fields[i] = string(field)
+	}
+	version := stationVersion{ETag: fields[0], LastModified: fields[1]}
+
+	data := &stationData{series: make([]elementSeries, len(supportedElements))}
+	for i := range data.series {
+		e, err := decodeSeries(in)
+		if err != nil {
+			return nil, stationVersion{}, time.Time{}, err
+		}
+		data.series[i] = e
+	}
+
+	sum := h.Sum32()
+	var stored uint32
+	if err := binary.Read(r, binary.LittleEndian, &stored); err != nil || stored != sum {
+		return nil, stationVersion{}, time.Time{}, errCorruptCache
+	}
+	return data, version, fetchedAt, nil
+}
+
+// decodeSeries reads one series and checks that days and flag runs are in order
+func decodeSeries(in io.Reader) (elementSeries, error) {
+	var counts [2]uint32
+	if err := binary.Read(in, binary.LittleEndian, &counts); err != nil {
+		return elementSeries{}, errCorruptCache
+	}
+	n, runs := counts[0], counts[1]
+	if n > maxSeriesLen || runs > n || (n > 0 && runs == 0) {
+		return elementSeries{}, errCorruptCache
+	}
+
+	e := elementSeries{days: make([]int32, n), values: make([]int16, n), flags: make([]flagRun, runs)}
+	if binary.Read(in, binary.LittleEndian, e.days) != nil || binary.Read(in, binary.LittleEndian, e.values) != nil {
+		return elementSeries{}, errCorruptCache
+	}
+	if !slices.IsSorted(e.days) {
+		return elementSeries{}, errCorruptCache
+	}
+	run := make([]byte, 7)
+	for i := range e.flags {
+		if _, err := io.ReadFull(in, run); err != nil {
+			return elementSeries{}, errCorruptCache
+		}
+		start := binary.LittleEndian.Uint32(run[0:4])
+		if (i == 0 && start != 0) || (i > 0 && start <= uint32(e.flags[i-1].start)) || start >= n {
+			return elementSeries{}, errCorruptCache
+		}
+		e.flags[i] = flagRun{start: int32(start), m: run[4], q: run[5], s: run[6]}
+	}
+	return e, nil
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// setupDiskCache enables a disk cache in a temporary directory for testing.
+func setupDiskCache(t *testing.T, ttl time.Duration, maxBytes int64) *diskCache {
+	c, err := openDiskCache(t.TempDir(), ttl, maxBytes)
+	if err != nil {
+		t.Fatalf("openDiskCache: %v", err)
+	}
+	oldDisk := disk
+	disk = c
+	t.Cleanup(func() {
+		disk = oldDisk
+	})
+	return c
+}
+
+func diskTestRows() []RawStationData {
+	return []RawStationData{
+		{Date: time.Date(1893, 1, 1, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: -250, QFlag: 'I'},
+		{Date: time.Date(1969, 12, 31, 0, 0, 0, 0, time.UTC), ElementType: "PRCP", Value: 18250, MFlag: 'T', SFlag: '0'},
+		{Date: time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC), ElementType: "SNWD", Value: 0},
+	}
+}
+
+func diskTestData() *stationData {
+	return newStationData(diskTestRows())
+}
+
+func TestEncodeDecodeStationData(t *testing.T) {
+	data := diskTestData()
+	fetchedAt := time.Date(2025, 6, 1, 12, 30, 0, 0, time.UTC)
+	version := stationVersion{ETag: `"abc123"`, LastModified: "Sun, 01 Jun 2025 10:00:00 GMT"}
+
+	var buf bytes.Buffer
+	if err := encodeStationData(&buf, data, version, fetchedAt); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if int64(buf.Len()) != encodedSize(data, version) {
+		t.Errorf("unexpected size %d", buf.Len())
+	}
+
+	decoded, decodedVersion, decodedAt, err := decodeStationData(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !decodedAt.Equal(fetchedAt) {
+		t.Errorf("expected fetchedAt %v, got %v", fetchedAt, decodedAt)
+	}
+	if decodedVersion != version {
+		t.Errorf("expected version %+v, got %+v", version, decodedVersion)
+	}
+	if got := allRows(decoded); !slices.Equal(got, diskTestRows()) {
+		t.Errorf("expected %+v, got %+v", diskTestRows(), got)
+	}
+
+	// a flipped bit and a truncated file are detected
+	corrupt := bytes.Clone(buf.Bytes())
+	corrupt[20] ^= 1
+	if _, _, _, err := decodeStationData(bytes.NewReader(corrupt)); err == nil {
+		t.Error("expected error for a flipped bit")
+	}
+	if _, _, _, err := decodeStationData(bytes.NewReader(buf.Bytes()[:buf.Len()-6])); err == nil {
+		t.Error("expected error for a truncated file")
+	}
+	if _, _, _, err := decodeStationData(bytes.NewReader([]byte("garbage"))); err == nil {
+		t.Error("expected error for garbage")
+	}
+}
+
+func TestDiskCache_PutGetAndRestart(t *testing.T) {
+	dir := t.TempDir()
+	c, err := openDiskCache(dir, time.Hour, 1<<20)
+	if err != nil {
+		t.Fatalf("openDiskCache: %v", err)
+	}
+	version := stationVersion{ETag: `"v1"`}
+	if err := c.put("STN001", diskTestData(), version, time.Now()); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if _, _, _, ok := c.get("UNKNOWN"); ok {
+		t.Error("expected a miss for an unknown station")
+	}
+
+	// a new cache on the same directory finds the entry
+	c, err = openDiskCache(dir, time.Hour, 1<<20)
+	if err != nil {
+		t.Fatalf("openDiskCache: %v", err)
+	}
+	data, cachedVersion, _, ok := c.get("STN001")
+	if !ok || data.len() != 3 || cachedVersion != version {
+		t.Fatalf("expected the entry to survive a restart, got %v %v %+v", ok, data, cachedVersion)
+	}
+
+	if err := c.put("../evil", diskTestData(), stationVersion{}, time.Now()); err == nil {
+		t.Error("expected error for an invalid station ID")
+	}
+}
+
+func TestDiskCache_TTL(t *testing.T) {
+	c, _ := openDiskCache(t.TempDir(), time.Hour, 1<<20)
+	c.put("OLD", diskTestData(), stationVersion{}, time.Now().Add(-2*time.Hour))
+
+	if _, _, _, ok := c.get("OLD"); ok {
+		t.Error("expected an expired entry to be a miss")
+	}
+	if _, err := os.Stat(c.path("OLD")); !os.IsNotExist(err) {
+		t.Error("expected the expired file to be removed")
+	}
+	if c.total != 0 {
+		t.Errorf("expected total size 0, got %d", c.total)
+	}
+}
+
+func TestDiskCache_ConcurrentAccess(t *testing.T) {
+	c, _ := openDiskCache(t.TempDir(), time.Hour, 1<<20)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id := []string{"A", "B"}[i%2]
+			for j := 0; j < 20; j++ {
+				c.put(id, diskTestData(), stationVersion{}, time.Now())
+				if data, _, _, ok := c.get(id); ok && data.len() != 3 {
+					t.Errorf("%s: read a partial entry", id)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if want := 2 * encodedSize(diskTestData(), stationVersion{}); c.total != want || len(c.entries) != 2 {
+		t.Errorf("expected 2 entries of %d bytes, got %d entries of %d bytes", want, len(c.entries), c.total)
+	}
+}
+
+func TestDiskCache_FailedReadKeepsNewerPut(t *testing.T) {
+	c, _ := openDiskCache(t.TempDir(), time.Hour, 1<<20)
+	c.put("A", diskTestData(), stationVersion{}, time.Now())
+	read := c.entries["A"]
+	// a put replaces the entry while a get fails on the old file
+	c.put("A", diskTestData(), stationVersion{}, time.Now())
+	c.removeEntry("A", read)
+
+	if _, _, _, ok := c.get("A"); !ok {
+		t.Error("expected the newer entry to survive")
+	}
+}
+
+func TestDiskCache_LRUEviction(t *testing.T) {
+	entrySize := encodedSize(diskTestData(), stationVersion{})
+	c, _ := openDiskCache(t.TempDir(), time.Hour, 2*entrySize)
+
+	c.put("A", diskTestData(), stationVersion{}, time.Now())
+	c.put("B", diskTestData(), stationVersion{}, time.Now())
+	// using A makes B the least recently used entry
+	time.Sleep(10 * time.Millisecond)
+	c.get("A")
+	c.put("C", diskTestData(), stationVersion{}, time.Now())
+
+	if _, _, _, ok := c.get("B"); ok {
+		t.Error("expected B to be evicted")
+	}
+	for _, id := range []string{"A", "C"} {
+		if _, _, _, ok := c.get(id); !ok {
+			t.Errorf("expected %s to be cached", id)
+		}
+	}
+	if c.total != 2*entrySize {
+		t.Errorf("expected total size %d, got %d", 2*entrySize, c.total)
+	}
+
+	// a smaller limit on restart evicts on open
+	c, _ = openDiskCache(c.dir, time.Hour, entrySize)
+	if len(c.entries) != 1 {
+		t.Errorf("expected 1 entry after reopening with a smaller limit, got %d", len(c.entries))
+	}
+}
+
+func TestDiskCache_IgnoresCorruptFiles(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "BAD.bin"), []byte("not a cache file"), 0o644)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("ignored"), 0o644)
+
+	c, err := openDiskCache(dir, time.Hour, 1<<20)
+	if err != nil {
+		t.Fatalf("openDiskCache: %v", err)
+	}
+	if len(c.entries) != 1 {
+		t.Errorf("expected 1 indexed entry, got %d", len(c.entries))
+	}
+	if _, _, _, ok := c.get("BAD"); ok {
+		t.Error("expected a corrupt file to be a miss")
+	}
+	if len(c.entries) != 0 {
+		t.Error("expected the corrupt entry to be dropped")
+	}
+}
+
+func TestGetStationData_UsesDiskCache(t *testing.T) {
+	setupCache(t)
+	setupDiskCache(t, time.Hour, 1<<20)
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write([]byte(`"ID","DATE","ELEMENT","DATA_VALUE","M_FLAG","Q_FLAG","S_FLAG","OBS_TIME"
+"STN001","20200101","TMIN",50,"","","S","0700"
+`))
+	}))
+	defer server.Close()
+	setupSource(t, &httpSource{baseURL: server.URL})
+
+	if _, err := getStationData("STN001"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// a restart clears the memory cache, the disk cache still has the station
+	setupCache(t)
+	data, err := getStationData("STN001")
+	if err != nil || data.len() != 1 || allRows(data)[0].Value != 50 {
+		t.Fatalf("unexpected data %+v %v", data, err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("expected 1 download, got %d", n)
+	}
+}
+
+func TestNewDiskCacheFromEnv(t *testing.T) {
+	t.Setenv("METEO_CACHE_DIR", "")
+	if c, err := newDiskCacheFromEnv(); c != nil || err != nil {
+		t.Errorf("expected no disk cache, got %v %v", c, err)
+	}
+
+	dir := filepath.Join(t.TempDir(), "cache")
+	t.Setenv("METEO_CACHE_DIR", dir)
+	t.Setenv("METEO_CACHE_TTL", "48h")
+	t.Setenv("METEO_CACHE_MAX_MB", "10")
+	c, err := newDiskCacheFromEnv()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.dir != dir || c.ttl != 48*time.Hour || c.maxBytes != 10<<20 {
+		t.Errorf("unexpected cache %+v", c)
+	}
+
+	t.Setenv("METEO_CACHE_TTL", "soon")
+	if _, err := newDiskCacheFromEnv(); err == nil {
+		t.Error("expected error for an invalid TTL")
+	}
+	t.Setenv("METEO_CACHE_TTL", "")
+	t.Setenv("METEO_CACHE_MAX_MB", "-1")
+	if _, err := newDiskCacheFromEnv(); err == nil {
+		t.Error("expected error for an invalid size")
+	}
+}
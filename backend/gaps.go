@@ -0,0 +1,284 @@
+package main
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// number of station files fetched at the same time to fill the coverage index
+const coverageFetchWorkers = 8
+
+// at most this many stations wait for their coverage to be indexed
+const coverageQueueSize = 1000
+
+// at most this many stations with unknown coverage are scheduled per search,
+// fewer if the search has a smaller limit
+const maxCoverageSchedules = 50
+
+// at most this many stations are kept in the coverage index
+const maxCoverageEntries = 10000
+
+// stationCoverage counts the days with data per element and year
+type stationCoverage map[string]yearCounts
+
+// yearCounts are the days with data of the years from first on
+type yearCounts struct {
+	first int
+	days  []uint16
+}
+
+// yearly coverage of recently fetched stations, filled by getStationData and
+// in the background for stations the coverage filter could not check.
+// Beyond maxEntries the least recently used stations are dropped.
+type coverageStore struct {
+	mu         sync.Mutex
+	stations   map[string]*list.Element
+	lru        *list.List // front is the most recently used *coverageEntry
+	maxEntries int
+}
+
+type coverageEntry struct {
+	id  string
+	cov stationCoverage
+}
+
+var coverageIndex = newCoverageStore(maxCoverageEntries)
+
+func newCoverageStore(maxEntries int) *coverageStore {
+	return &coverageStore{
+		stations:   make(map[string]*list.Element),
+		lru:        list.New(),
+		maxEntries: maxEntries,
+	}
+}
+
+func (c *coverageStore) get(id string) (stationCoverage, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.stations[id]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	return el.Value.(*coverageEntry).cov, true
+}
+
+func (c *coverageStore) set(id string, cov stationCoverage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.stations[id]; ok {
+		el.Value.(*coverageEntry).cov = cov
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.stations[id] = c.lru.PushFront(&coverageEntry{id: id, cov: cov})
+	for c.lru.Len() > c.maxEntries {
+		delete(c.stations, c.lru.Remove(c.lru.Back()).(*coverageEntry).id)
+	}
+}
+
+func (c *coverageStore) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// buildCoverage counts the days with a value per element and year
+func buildCoverage(data *stationData) stationCoverage {
+	cov := make(stationCoverage)
+	for i, e := range data.series {
+		if e.len() == 0 {
+			continue
+		}
+		first, _, _ := civilDate(e.days[0])
+		last, _, _ := civilDate(e.days[e.len()-1])
+		counts := yearCounts{first: first, days: make([]uint16, last-first+1)}
+		for j, day := range e.days {
+			//the days are sorted, duplicates follow each other
+			if j > 0 && day == e.days[j-1] {
+				continue
+			}
+			year, _, _ := civilDate(day)
+			counts.days[year-first]++
+		}
+		cov[supportedElements[i]] = counts
+	}
+	return cov
+}
+
+// days returns the number of days with a value of the element in the year
+func (c stationCoverage) days(element string, year int) int {
+	counts, ok := c[element]
+	if !ok || year < counts.first || year >= counts.first+len(counts.days) {
+		return 0
+	}
+	return int(counts.days[year-counts.first])
+}
+
+// fraction returns the share of days from start to end year with a value
+func (c stationCoverage) fraction(element string, startYear int, endYear int) float64 {
+	days, observed := 0, 0
+	for year := startYear; year <= endYear; year++ {
+		days += time.Date(year, 12, 31, 0, 0, 0, 0, time.UTC).YearDay()
+		observed += c.days(element, year)
+	}
+	if days == 0 {
+		return 0
+	}
+	return float64(observed) / float64(days)
+}
+
+// coverageIndexer downloads the stations a search could not check and
+// indexes their coverage. The data is not put into the station caches, so
+// searches do not push out the entries of other requests.
+type coverageIndexer struct {
+	mu      sync.Mutex
+	pending map[string]bool
+	queue   chan string
+}
+
+var coverageQueue = newCoverageIndexer(coverageQueueSize)
+
+func newCoverageIndexer(size int) *coverageIndexer {
+	return &coverageIndexer{pending: make(map[string]bool), queue: make(chan string, size)}
+}
+
+// schedule queues the station unless it is already waiting. With a full
+// queue the station is skipped, a later search schedules it again.
+func (q *coverageIndexer) schedule(id string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.pending[id] {
+		return
+	}
+	select {
+	case q.queue <- id:
+		q.pending[id] = true
+	default:
+	}
+}
+
+// start indexes the queued stations with the given number of workers until
+// stop is called, stop waits for the running downloads
+func (q *coverageIndexer) start(workers int) (stop func()) {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case id := <-q.queue:
+					indexCoverage(id)
+					q.mu.Lock()
+					delete(q.pending, id)
+					q.mu.Unlock()
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+// indexCoverage adds the coverage of the station to the index, using cached
+// data if there is any. Downloaded data goes to the disk cache only, so a
+// later request for the station does not download it again but the memory
+// cache keeps the entries of other requests.
+func indexCoverage(id string) {
+	if _, ok := coverageIndex.get(id); ok {
+		return
+	}
+	data, ok := cache.peek(id)
+	if !ok && disk != nil {
+		data, _, _, ok = disk.get(id)
+	}
+	if !ok {
+		var version stationVersion
+		var err error
+		data, version, err = loadStationData(source, id, stationVersion{})
+		if err != nil {
+			//no log line per station while the circuit is open
+			if !errors.Is(err, errSourceUnavailable) {
+				fmt.Printf("Fehler beim Indizieren von %s: %v\n", id, err)
+			}
+			return
+		}
+		if disk != nil {
+			if err := disk.put(id, data, version, time.Now()); err != nil {
+				fmt.Printf("Cache-Fehler: %v\n", err)
+			}
+		}
+	}
+	coverageIndex.set(id, buildCoverage(data))
+}
+
+// coveragePendingError reports the stations a search left out because their
+// coverage is not known yet
+type coveragePendingError struct {
+	stations int
+}
+
+func (e *coveragePendingError) Error() string {
+	return fmt.Sprintf("%d stations have not been checked for gaps yet and are not listed. The nearest of them are being checked, please try again in a moment.", e.stations)
+}
+
+// meetsCoverage checks that every requested element (default TMIN and TMAX)
+// has values on at least minCoverage of the days in the filter's years
+func (f stationFilter) meetsCoverage(cov stationCoverage) bool {
+	elements := f.Elements
+	if len(elements) == 0 {
+		elements = defaultElements
+	}
+	for _, element := range elements {
+		if cov.fraction(element, f.StartYear, f.EndYear) < f.MinCoverage {
+			return false
+		}
+	}
+	return true
+}
+
+// filterByCoverage keeps the stations meeting the filter's minCoverage, in
+// their order, until limit stations are found (0 means no limit). Stations
+// with unknown coverage are reported with a coveragePendingError, the first
+// limit of them (at most maxCoverageSchedules) are scheduled for indexing.
+// The search does not wait for their download.
+func filterByCoverage(stations []*Station, filter stationFilter, limit int) ([]*Station, error) {
+	schedules := maxCoverageSchedules
+	if limit > 0 && limit < schedules {
+		schedules = limit
+	}
+
+	result := []*Station{}
+	unchecked := 0
+	for _, s := range stations {
+		cov, ok := coverageIndex.get(s.ID)
+		if !ok {
+			if unchecked < schedules {
+				coverageQueue.schedule(s.ID)
+			}
+			unchecked++
+			continue
+		}
+		if !filter.meetsCoverage(cov) {
+			continue
+		}
+		result = append(result, s)
+		if len(result) == limit {
+			break
+		}
+	}
+	if unchecked > 0 {
+		return result, &coveragePendingError{stations: unchecked}
+	}
+	return result, nil
+}
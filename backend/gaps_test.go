@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setupCoverage resets the global coverage index and queue for testing.
+// The queue is not worked off unless the test starts it.
+func setupCoverage(t *testing.T) {
+	oldIndex, oldQueue := coverageIndex, coverageQueue
+	coverageIndex = newCoverageStore(maxCoverageEntries)
+	coverageQueue = newCoverageIndexer(coverageQueueSize)
+	t.Cleanup(func() {
+		coverageIndex, coverageQueue = oldIndex, oldQueue
+	})
+}
+
+// yearsOfData returns daily TMIN/TMAX values for every day of the years
+func yearsOfData(from int, to int) []RawStationData {
+	var raw []RawStationData
+	for year := from; year <= to; year++ {
+		for m := time.January; m <= time.December; m++ {
+			raw = append(raw, fullMonth(year, m, "TMIN", 0)...)
+			raw = append(raw, fullMonth(year, m, "TMAX", 100)...)
+		}
+	}
+	return raw
+}
+
+func TestBuildCoverage(t *testing.T) {
+	raw := yearsOfData(2000, 2001)
+	// duplicate values of a day are counted once
+	raw = append(raw, RawStationData{Date: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC), ElementType: "TMIN"})
+
+	cov := buildCoverage(newStationData(raw))
+	if cov.days("TMIN", 2000) != 366 || cov.days("TMAX", 2001) != 365 {
+		t.Errorf("unexpected day counts %v", cov)
+	}
+	if f := cov.fraction("TMIN", 2000, 2001); f != 1 {
+		t.Errorf("expected full coverage, got %v", f)
+	}
+	if f := cov.fraction("TMIN", 2000, 2003); !approxEqual(f, 731.0/1461, 0.0001) {
+		t.Errorf("expected half coverage, got %v", f)
+	}
+	if f := cov.fraction("PRCP", 2000, 2001); f != 0 {
+		t.Errorf("expected no PRCP coverage, got %v", f)
+	}
+}
+
+func TestCoverageStore_EvictsLeastRecentlyUsed(t *testing.T) {
+	c := newCoverageStore(2)
+	cov := buildCoverage(newStationData(yearsOfData(2020, 2020)))
+	c.set("A", cov)
+	c.set("B", cov)
+	// using A makes B the least recently used station
+	c.get("A")
+	c.set("C", cov)
+
+	if _, ok := c.get("B"); ok {
+		t.Error("expected B to be evicted")
+	}
+	if _, ok := c.get("A"); !ok {
+		t.Error("expected A to be kept")
+	}
+	if n := c.len(); n != 2 {
+		t.Errorf("expected 2 stations, got %d", n)
+	}
+}
+
+func TestFindStations_MinCoverage(t *testing.T) {
+	setupCoverage(t)
+	setupCache(t)
+	lat, long := 52.52, 13.405
+	setupGlobalState(t,
+		[]*Station{
+			{ID: "FULL", Latitude: &lat, Longitude: &long},
+			{ID: "HOLE", Latitude: &lat, Longitude: &long},
+		},
+		map[string]*StationInventory{
+			"FULL": temperatureInventory(1950, 2020),
+			"HOLE": temperatureInventory(1950, 2020),
+		},
+	)
+	// HOLE has a 40 year gap in the middle
+	coverageIndex.set("FULL", buildCoverage(newStationData(yearsOfData(1950, 2020))))
+	coverageIndex.set("HOLE", buildCoverage(newStationData(append(yearsOfData(1950, 1960), yearsOfData(2001, 2020)...))))
+
+	filter := stationFilter{StartYear: 1950, EndYear: 2020}
+	if result, _ := findStations(52.52, 13.405, 100, 10, filter); len(result) != 2 {
+		t.Errorf("expected both stations without minCoverage, got %d", len(result))
+	}
+	filter.MinCoverage = 0.9
+	result, _ := findStations(52.52, 13.405, 100, 10, filter)
+	if len(result) != 1 || result[0].ID != "FULL" {
+		t.Errorf("expected only FULL, got %v", result)
+	}
+	// the gap does not matter for the recent years
+	filter.StartYear = 2001
+	if result, _ := findStations(52.52, 13.405, 100, 10, filter); len(result) != 2 {
+		t.Errorf("expected both stations for 2001–2020, got %d", len(result))
+	}
+}
+
+func TestFindStations_MinCoverageIndexesInBackground(t *testing.T) {
+	setupCoverage(t)
+	setupCache(t)
+	setupDiskCache(t, time.Hour, 1<<20)
+
+	var csv strings.Builder
+	csv.WriteString(`"ID","DATE","ELEMENT","DATA_VALUE","M_FLAG","Q_FLAG","S_FLAG","OBS_TIME"` + "\n")
+	for _, d := range yearsOfData(2019, 2020) {
+		fmt.Fprintf(&csv, "\"LAZY\",\"%s\",\"%s\",%d,\"\",\"\",\"S\",\"0700\"\n", d.Date.Format("20060102"), d.ElementType, d.Value)
+	}
+	server := newMockS3Server(map[string]string{"LAZY": csv.String()})
+	defer server.Close()
+	setupSource(t, &httpSource{baseURL: server.URL})
+
+	lat, long := 52.52, 13.405
+	setupGlobalState(t,
+		[]*Station{
+			{ID: "LAZY", Latitude: &lat, Longitude: &long},
+			{ID: "MISSING", Latitude: &lat, Longitude: &long},
+		},
+		map[string]*StationInventory{
+			"LAZY":    temperatureInventory(2019, 2020),
+			"MISSING": temperatureInventory(2019, 2020),
+		},
+	)
+
+	filter, err := parseStationFilter(url.Values{"minCoverage": {"0.95"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	filter.StartYear, filter.EndYear = 2019, 2020
+
+	// the search does not wait for the downloads, both stations are unchecked
+	result, err := findStations(52.52, 13.405, 100, 10, filter)
+	var pending *coveragePendingError
+	if len(result) != 0 || !errors.As(err, &pending) || pending.stations != 2 {
+		t.Fatalf("expected 2 unchecked stations, got %v %v", result, err)
+	}
+
+	stop := coverageQueue.start(2)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		coverageQueue.mu.Lock()
+		n := len(coverageQueue.pending)
+		coverageQueue.mu.Unlock()
+		if n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the queue was not worked off")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	stop()
+
+	if _, ok := coverageIndex.get("LAZY"); !ok {
+		t.Error("expected the coverage of LAZY to be indexed")
+	}
+	if _, ok := cache.peek("LAZY"); ok {
+		t.Error("expected the indexed data to stay out of the station cache")
+	}
+	if _, _, _, ok := disk.get("LAZY"); !ok {
+		t.Error("expected the downloaded data in the disk cache")
+	}
+	// MISSING could not be downloaded and is still reported as unchecked
+	result, err = findStations(52.52, 13.405, 100, 10, filter)
+	if len(result) != 1 || result[0].ID != "LAZY" || !errors.As(err, &pending) || pending.stations != 1 {
+		t.Errorf("expected LAZY and 1 unchecked station, got %v %v", result, err)
+	}
+
+	for _, v := range []string{"0", "1.5", "abc"} {
+		if _, err := parseStationFilter(url.Values{"minCoverage": {v}}); err == nil {
+			t.Errorf("%q: expected error", v)
+		}
+	}
+}
+
+func TestStationsHandler_MinCoveragePartial(t *testing.T) {
+	setupCoverage(t)
+	lat, long := 52.52, 13.405
+	setupGlobalState(t,
+		[]*Station{{ID: "UNKNOWN", Latitude: &lat, Longitude: &long}},
+		map[string]*StationInventory{"UNKNOWN": temperatureInventory(1950, 2020)},
+	)
+
+	req := httptest.NewRequest(http.MethodGet, "/stations?lat=52.52&long=13.405&radius=100&limit=10&start=1950&end=2020&minCoverage=0.9", nil)
+	rec := httptest.NewRecorder()
+	stationsHandler(rec, req)
+
+	var resp Response
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if rec.Code != http.StatusOK || !strings.Contains(resp.ErrorMsg, "1 stations have not been checked") {
+		t.Errorf("expected a partial result, got %d %q", rec.Code, resp.ErrorMsg)
+	}
+	if !coverageQueue.pending["UNKNOWN"] {
+		t.Error("expected UNKNOWN to be scheduled for indexing")
+	}
+}
+
+func TestFilterByCoverage_Limit(t *testing.T) {
+	setupCoverage(t)
+	var stations []*Station
+	for i := 0; i < 20; i++ {
+		id := fmt.Sprintf("STN%03d", i)
+		stations = append(stations, &Station{ID: id})
+		coverageIndex.set(id, buildCoverage(newStationData(yearsOfData(2020, 2020))))
+	}
+
+	filter := stationFilter{StartYear: 2020, EndYear: 2020, MinCoverage: 1}
+	result, err := filterByCoverage(stations, filter, 5)
+	if err != nil || len(result) != 5 || result[0].ID != "STN000" || result[4].ID != "STN004" {
+		t.Errorf("expected the first 5 stations, got %v", result)
+	}
+	if result, _ := filterByCoverage(stations, filter, 0); len(result) != 20 {
+		t.Errorf("expected all stations without a limit, got %d", len(result))
+	}
+}
+
+func TestFilterByCoverage_SchedulesUpToLimit(t *testing.T) {
+	var stations []*Station
+	for i := 0; i < 2*maxCoverageSchedules; i++ {
+		stations = append(stations, &Station{ID: fmt.Sprintf("STN%03d", i)})
+	}
+	filter := stationFilter{StartYear: 2020, EndYear: 2020, MinCoverage: 1}
+
+	for _, tc := range []struct{ limit, scheduled int }{{5, 5}, {0, maxCoverageSchedules}} {
+		setupCoverage(t)
+		_, err := filterByCoverage(stations, filter, tc.limit)
+		var pending *coveragePendingError
+		if !errors.As(err, &pending) || pending.stations != len(stations) {
+			t.Errorf("limit %d: expected %d unchecked stations, got %v", tc.limit, len(stations), err)
+		}
+		if n := len(coverageQueue.pending); n != tc.scheduled || !coverageQueue.pending["STN000"] {
+			t.Errorf("limit %d: expected the first %d stations to be scheduled, got %d", tc.limit, tc.scheduled, n)
+		}
+	}
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// default base period of the percentile thresholds (ETCCDI)
+const (
+	defaultIndicesBaseStart = 1961
+	defaultIndicesBaseEnd   = 1990
+)
+
+const (
+	// a year gets no indices of an element if more days are missing (ETCCDI)
+	indicesMaxMissingDays = 15
+	// minimum length of a warm or cold spell in days
+	spellMinLength = 6
+	// a calendar day threshold needs values from this share of the base window
+	minThresholdFraction = 0.8
+)
+
+// ClimateIndices holds the ETCCDI temperature indices of one year.
+// Counts are in days, TXx/TNn/DTR in °C and TX90p/TN10p in percent of days.
+type ClimateIndices struct {
+	Year   int      `json:"year"`
+	FD     *int     `json:"fd"`
+	ID     *int     `json:"id"`
+	SU     *int     `json:"su"`
+	TR     *int     `json:"tr"`
+	TXx    *float64 `json:"txx"`
+	TNn    *float64 `json:"tnn"`
+	TX90p  *float64 `json:"tx90p"`
+	TN10p  *float64 `json:"tn10p"`
+	DTR    *float64 `json:"dtr"`
+	WSDI   *int     `json:"wsdi"`
+	CSDI   *int     `json:"csdi"`
+	TXDays int      `json:"txDays"`
+	TNDays int      `json:"tnDays"`
+}
+
+type StationIndicesResponse struct {
+	BaseStart int               `json:"baseStart"`
+	BaseEnd   int               `json:"baseEnd"`
+	Years     []*ClimateIndices `json:"years"`
+}
+
+// dayTemperature holds TX and TN of one calendar day in °C
+type dayTemperature struct {
+	date         time.Time
+	tx, tn       float64
+	hasTX, hasTN bool
+}
+
+// dailyTemperatures returns one entry per day from the first to the last
+// observation, so that consecutive entries are consecutive days.
+func dailyTemperatures(data *stationData) []dayTemperature {
+	tmax, tmin := data.element("TMAX"), data.element("TMIN")
+	first, last := int32(math.MaxInt32), int32(math.MinInt32)
+	for _, e := range []*elementSeries{tmax, tmin} {
+		if e.len() > 0 {
+			first = min(first, e.days[0])
+			last = max(last, e.days[e.len()-1])
+		}
+	}
+	if first > last {
+		return nil
+	}
+
+	days := make([]dayTemperature, last-first+1)
+	for i := range days {
+		days[i].date = dateOf(first + int32(i))
+	}
+	for j, day := range tmax.days {
+		days[day-first].tx = float64(tmax.values[j]) / elementScale("TMAX")
+		days[day-first].hasTX = true
+	}
+	for j, day := range tmin.days {
+		days[day-first].tn = float64(tmin.values[j]) / elementScale("TMIN")
+		days[day-first].hasTN = true
+	}
+	return days
+}
+
+// calendarDay returns the index of the day in a 365 day calendar,
+// 29 February shares the index of 28 February.
+func calendarDay(t time.Time) int {
+	if t.Month() == time.February && t.Day() == 29 {
+		return time.Date(2001, time.February, 28, 0, 0, 0, 0, time.UTC).YearDay() - 1
+	}
+	return time.Date(2001, t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).YearDay() - 1
+}
+
+// quantile returns the p-quantile of sorted values (Hyndman & Fan type 8,
+// as used by climdex).
+func quantile(sorted []float64, p float64) float64 {
+	n := float64(len(sorted))
+	h := (n+1.0/3)*p + 1.0/3
+	switch {
+	case h <= 1:
+		return sorted[0]
+	case h >= n:
+		return sorted[len(sorted)-1]
+	}
+	lo := math.Floor(h)
+	return sorted[int(lo)-1] + (h-lo)*(sorted[int(lo)]-sorted[int(lo)-1])
+}
+
+// percentileThresholds returns the p-quantile of TX (or TN) for every calendar
+// day, taken from a 5 day window around that day in the base period.
+// Days with too few values in the window get NaN.
+func percentileThresholds(days []dayTemperature, baseStart int, baseEnd int, p float64, useTX bool) [365]float64 {
+	var windows [365][]float64
+	for _, d := range days {
+		if d.date.Year() < baseStart || d.date.Year() > baseEnd {
+			continue
+		}
+		val, ok := d.tn, d.hasTN
+		if useTX {
+			val, ok = d.tx, d.hasTX
+		}
+		if !ok {
+			continue
+		}
+		cd := calendarDay(d.date)
+		for offset := -2; offset <= 2; offset++ {
+			w := (cd + offset + 365) % 365
+			windows[w] = append(windows[w], val)
+		}
+	}
+
+	minValues := int(math.Ceil(float64((baseEnd-baseStart+1)*5) * minThresholdFraction))
+	var thresholds [365]float64
+	for i, values := range windows {
+		if len(values) == 0 || len(values) < minValues {
+			thresholds[i] = math.NaN()
+			continue
+		}
+		slices.Sort(values)
+		thresholds[i] = quantile(values, p)
+	}
+	return thresholds
+}
+
+// yearIndices accumulates the daily contributions to one year's indices
+type yearIndices struct {
+	txDays, tnDays      int
+	fd, id, su, tr      int
+	txx, tnn            float64
+	txAbove, txCompared int
+	tnBelow, tnCompared int
+	dtrSum              float64
+	dtrDays             int
+	wsdi, csdi          int
+}
+
+// calculateIndices computes the ETCCDI indices per year. Percentile based
+// indices use thresholds of the baseStart–baseEnd period (without the
+// bootstrapping climdex applies to years inside the base period).
+// Indices of an element are only reported for years with at most 15 missing
+// days, unless checkCompleteness is false.
+func calculateIndices(data *stationData, baseStart int, baseEnd int, checkCompleteness bool) []*ClimateIndices {
+	days := dailyTemperatures(data)
+	if len(days) == 0 {
+		return nil
+	}
+	tx90 := percentileThresholds(days, baseStart, baseEnd, 0.9, true)
+	tn10 := percentileThresholds(days, baseStart, baseEnd, 0.1, false)
+
+	years := make(map[int]*yearIndices)
+	for _, d := range days {
+		y, ok := years[d.date.Year()]
+		if !ok {
+			y = &yearIndices{txx: math.Inf(-1), tnn: math.Inf(1)}
+			years[d.date.Year()] = y
+		}
+		cd := calendarDay(d.date)
+		if d.hasTX {
+			y.txDays++
+			if d.tx < 0 {
+				y.id++
+			}
+			if d.tx > 25 {
+				y.su++
+			}
+			y.txx = math.Max(y.txx, d.tx)
+			if !math.IsNaN(tx90[cd]) {
+				y.txCompared++
+				if d.tx > tx90[cd] {
+					y.txAbove++
+				}
+			}
+		}
+		if d.hasTN {
+			y.tnDays++
+			if d.tn < 0 {
+				y.fd++
+			}
+			if d.tn > 20 {
+				y.tr++
+			}
+			y.tnn = math.Min(y.tnn, d.tn)
+			if !math.IsNaN(tn10[cd]) {
+				y.tnCompared++
+				if d.tn < tn10[cd] {
+					y.tnBelow++
+				}
+			}
+		}
+		if d.hasTX && d.hasTN {
+			y.dtrSum += d.tx - d.tn
+			y.dtrDays++
+		}
+	}
+
+	// warm and cold spells, days are counted in the year they fall into
+	countSpells(days, func(d dayTemperature) bool {
+		cd := calendarDay(d.date)
+		return d.hasTX && !math.IsNaN(tx90[cd]) && d.tx > tx90[cd]
+	}, func(year int) { years[year].wsdi++ })
+	countSpells(days, func(d dayTemperature) bool {
+		cd := calendarDay(d.date)
+		return d.hasTN && !math.IsNaN(tn10[cd]) && d.tn < tn10[cd]
+	}, func(year int) { years[year].csdi++ })
+
+	var result []*ClimateIndices
+	for year, y := range years {
+		daysInYear := time.Date(year, 12, 31, 0, 0, 0, 0, time.UTC).YearDay()
+		txValid := y.txDays > 0 && (!checkCompleteness || daysInYear-y.txDays <= indicesMaxMissingDays)
+		tnValid := y.tnDays > 0 && (!checkCompleteness || daysInYear-y.tnDays <= indicesMaxMissingDays)
+
+		ci := &ClimateIndices{Year: year, TXDays: y.txDays, TNDays: y.tnDays}
+		if txValid {
+			ci.ID = intPtr(y.id)
+			ci.SU = intPtr(y.su)
+			ci.TXx = roundedPtr(y.txx)
+			if y.txCompared > 0 {
+				ci.TX90p = roundedPtr(float64(y.txAbove) / float64(y.txCompared) * 100)
+				ci.WSDI = intPtr(y.wsdi)
+			}
+		}
+		if tnValid {
+			ci.FD = intPtr(y.fd)
+			ci.TR = intPtr(y.tr)
+			ci.TNn = roundedPtr(y.tnn)
+			if y.tnCompared > 0 {
+				ci.TN10p = roundedPtr(float64(y.tnBelow) / float64(y.tnCompared) * 100)
+				ci.CSDI = intPtr(y.csdi)
+			}
+		}
+		if txValid && tnValid && y.dtrDays > 0 {
+			ci.DTR = roundedPtr(y.dtrSum / float64(y.dtrDays))
+		}
+		result = append(result, ci)
+	}
+	slices.SortFunc(result, func(a, b *ClimateIndices) int { return a.Year - b.Year })
+	return result
+}
+
+// countSpells calls add for every day that is part of a run of at least
+// spellMinLength consecutive days matching the condition.
+func countSpells(days []dayTemperature, match func(dayTemperature) bool, add func(year int)) {
+	start := -1
+	for i := 0; i <= len(days); i++ {
+		if i < len(days) && match(days[i]) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 && i-start >= spellMinLength {
+			for j := start; j < i; j++ {
+				add(days[j].date.Year())
+			}
+		}
+		start = -1
+	}
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func roundedPtr(f float64) *float64 {
+	f = math.Round(f*10) / 10
+	return &f
+}
+
+// parseIndicesParams reads the baseStart/baseEnd years and completeness=false.
+func parseIndicesParams(q url.Values) (int, int, bool, error) {
+	baseStart, baseEnd := defaultIndicesBaseStart, defaultIndicesBaseEnd
+	checkCompleteness := true
+	var err error
+	if s := q.Get("baseStart"); s != "" {
+		if baseStart, err = strconv.Atoi(s); err != nil {
+			return 0, 0, false, fmt.Errorf("invalid baseStart year %q", s)
+		}
+	}
+	if s := q.Get("baseEnd"); s != "" {
+		if baseEnd, err = strconv.Atoi(s); err != nil {
+			return 0, 0, false, fmt.Errorf("invalid baseEnd year %q", s)
+		}
+	}
+	if baseEnd < baseStart {
+		return 0, 0, false, fmt.Errorf("baseStart %d is after baseEnd %d", baseStart, baseEnd)
+	}
+	if s := q.Get("completeness"); s != "" {
+		if checkCompleteness, err = strconv.ParseBool(s); err != nil {
+			return 0, 0, false, fmt.Errorf("invalid completeness value %q", s)
+		}
+	}
+	return baseStart, baseEnd, checkCompleteness, nil
+}
+
+func indicesHandler(w http.ResponseWriter, r *http.Request) {
+	//cors handling
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+	q := r.URL.Query()
+	id := q.Get("id")
+	enc := json.NewEncoder(w)
+
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		response := Response{Data: nil, ErrorMsg: "Please provide a valid station ID."}
+		enc.Encode(response)
+		return
+	}
+	baseStart, baseEnd, checkCompleteness, err := parseIndicesParams(q)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := Response{Data: nil, ErrorMsg: "Please provide a valid base period (baseStart/baseEnd years)."}
+		enc.Encode(response)
+		return
+	}
+	qc, err := parseQCFilter(q)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := Response{Data: nil, ErrorMsg: "Please provide valid quality flag options (includeFlagged=true|false, qflags=D,G,...)."}
+		enc.Encode(response)
+		return
+	}
+
+	rawData, err := getStationData(id)
+	if err != nil {
+		w.WriteHeader(fetchErrorStatus(err))
+		response := Response{Data: nil, ErrorMsg: err.Error()}
+		enc.Encode(response)
+		return
+	}
+
+	indices := StationIndicesResponse{
+		BaseStart: baseStart,
+		BaseEnd:   baseEnd,
+		Years:     calculateIndices(applyQCFilter(rawData, qc), baseStart, baseEnd, checkCompleteness),
+	}
+	response := Response{Data: indices, ErrorMsg: ""}
+	enc.Encode(response)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestQuantile(t *testing.T) {
+	values := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	tests := []struct {
+		p    float64
+		want float64
+	}{
+		{0.5, 5.5},
+		{0.0, 1},
+		{1.0, 10},
+		{0.9, 9.6333},
+	}
+	for _, tt := range tests {
+		if got := quantile(values, tt.p); !approxEqual(got, tt.want, 0.001) {
+			t.Errorf("quantile(%v) = %v, want %v", tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestCalendarDay(t *testing.T) {
+	if got := calendarDay(time.Date(2004, time.February, 29, 0, 0, 0, 0, time.UTC)); got != 58 {
+		t.Errorf("expected 29 Feb to map to 58, got %d", got)
+	}
+	if got := calendarDay(time.Date(2004, time.March, 1, 0, 0, 0, 0, time.UTC)); got != 59 {
+		t.Errorf("expected 1 Mar of a leap year to map to 59, got %d", got)
+	}
+	if got := calendarDay(time.Date(2003, time.December, 31, 0, 0, 0, 0, time.UTC)); got != 364 {
+		t.Errorf("expected 31 Dec to map to 364, got %d", got)
+	}
+}
+
+func TestCountSpells(t *testing.T) {
+	start := time.Date(2000, time.December, 28, 0, 0, 0, 0, time.UTC)
+	// 7 hot days across new year, a break, then a run of 5 (too short)
+	hot := []bool{true, true, true, true, true, true, true, false, true, true, true, true, true}
+	days := make([]dayTemperature, len(hot))
+	for i := range days {
+		days[i] = dayTemperature{date: start.AddDate(0, 0, i), hasTX: hot[i]}
+	}
+
+	counts := map[int]int{}
+	countSpells(days, func(d dayTemperature) bool { return d.hasTX }, func(year int) { counts[year]++ })
+	if counts[2000] != 4 || counts[2001] != 3 {
+		t.Errorf("expected 4 spell days in 2000 and 3 in 2001, got %v", counts)
+	}
+}
+
+func TestCalculateIndices_FixedThresholds(t *testing.T) {
+	var raw []RawStationData
+	for m := time.January; m <= time.December; m++ {
+		// winter: TN -5 °C, TX 3 °C; July: TN 21 °C, TX 30 °C; else TN 5 °C, TX 15 °C
+		tmin, tmax := 50, 150
+		switch m {
+		case time.January, time.February:
+			tmin, tmax = -50, 30
+		case time.July:
+			tmin, tmax = 210, 300
+		}
+		raw = append(raw, fullMonth(2001, m, "TMIN", tmin)...)
+		raw = append(raw, fullMonth(2001, m, "TMAX", tmax)...)
+	}
+	// a single ice day
+	raw = append(raw, RawStationData{Date: time.Date(2002, time.January, 1, 0, 0, 0, 0, time.UTC), ElementType: "TMAX", Value: -10})
+
+	indices := calculateIndices(newStationData(raw), 2001, 2001, true)
+	if len(indices) != 2 {
+		t.Fatalf("expected 2 years, got %d", len(indices))
+	}
+	y := indices[0]
+	if y.Year != 2001 || y.FD == nil || *y.FD != 59 || *y.ID != 0 || *y.SU != 31 || *y.TR != 31 {
+		t.Errorf("unexpected counts %+v", y)
+	}
+	if *y.TXx != 30 || *y.TNn != -5 {
+		t.Errorf("expected TXx 30 and TNn -5, got %v %v", *y.TXx, *y.TNn)
+	}
+	// (59*8 + 31*9 + 275*10) / 365
+	if y.DTR == nil || !approxEqual(*y.DTR, 9.6, 0.001) {
+		t.Errorf("expected DTR 9.6, got %v", y.DTR)
+	}
+	if y.TXDays != 365 || y.TNDays != 365 {
+		t.Errorf("expected 365 days of each element, got %d/%d", y.TXDays, y.TNDays)
+	}
+
+	// 2002 has a single TX value and is incomplete
+	if indices[1].ID != nil || indices[1].TXDays != 1 {
+		t.Errorf("expected no indices for incomplete 2002, got %+v", indices[1])
+	}
+	indices = calculateIndices(newStationData(raw), 2001, 2001, false)
+	if indices[1].ID == nil || *indices[1].ID != 1 {
+		t.Errorf("expected 1 ice day without completeness check, got %+v", indices[1])
+	}
+}
+
+func TestCalculateIndices_Percentiles(t *testing.T) {
+	// TX and TN rise by 1 °C per year, so 2009 is above every 90th percentile
+	// and 2000 below every 10th percentile of the 2001–2008 base period
+	raw := completeYears(2000, 2009,
+		func(y int, m time.Month) int { return (y - 2000) * 10 },
+		func(y int, m time.Month) int { return 100 + (y-2000)*10 },
+	)
+
+	indices := calculateIndices(newStationData(raw), 2001, 2008, true)
+	if len(indices) != 10 {
+		t.Fatalf("expected 10 years, got %d", len(indices))
+	}
+	first, middle, last := indices[0], indices[5], indices[9]
+	if last.TX90p == nil || *last.TX90p != 100 || *last.WSDI != 365 {
+		t.Errorf("expected TX90p 100 and WSDI 365 in 2009, got %v %v", last.TX90p, last.WSDI)
+	}
+	if first.TN10p == nil || *first.TN10p != 100 || *first.CSDI != 366 {
+		t.Errorf("expected TN10p 100 and CSDI 366 in 2000, got %v %v", first.TN10p, first.CSDI)
+	}
+	if *middle.TX90p != 0 || *middle.TN10p != 0 || *middle.WSDI != 0 || *middle.CSDI != 0 {
+		t.Errorf("expected no exceedances in 2005, got %+v", middle)
+	}
+
+	// without base period data the percentile indices are not available
+	indices = calculateIndices(newStationData(raw), 1961, 1990, true)
+	if indices[0].TX90p != nil || indices[0].WSDI != nil || indices[0].FD == nil {
+		t.Errorf("expected only threshold free indices, got %+v", indices[0])
+	}
+}
+
+func TestPercentileThresholds_SparseBase(t *testing.T) {
+	// a single year cannot fill a ten year base period
+	raw := completeYears(2000, 2000,
+		func(y int, m time.Month) int { return 0 },
+		func(y int, m time.Month) int { return 100 },
+	)
+	thresholds := percentileThresholds(dailyTemperatures(newStationData(raw)), 2000, 2009, 0.9, true)
+	if !math.IsNaN(thresholds[100]) {
+		t.Errorf("expected NaN threshold, got %v", thresholds[100])
+	}
+}
+
+func TestIndicesHandler(t *testing.T) {
+	setupCache(t)
+
+	rawData := completeYears(2000, 2001,
+		func(y int, m time.Month) int { return -10 },
+		func(y int, m time.Month) int { return 260 },
+	)
+	cache.put("TESTSTATION", newStationData(rawData), stationVersion{}, time.Now())
+
+	req := httptest.NewRequest(http.MethodGet, "/station/indices?id=TESTSTATION&baseStart=2000&baseEnd=2001", nil)
+	rec := httptest.NewRecorder()
+	indicesHandler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var resp struct {
+		Data     StationIndicesResponse `json:"data"`
+		ErrorMsg string                 `json:"errorMessage"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Data.BaseStart != 2000 || resp.Data.BaseEnd != 2001 || len(resp.Data.Years) != 2 {
+		t.Fatalf("unexpected response %+v", resp.Data)
+	}
+	if y := resp.Data.Years[0]; y.FD == nil || *y.FD != 366 || *y.SU != 366 {
+		t.Errorf("expected 366 frost and summer days in 2000, got %+v", y)
+	}
+
+	for _, query := range []string{"", "?id=TESTSTATION&baseStart=1990&baseEnd=1980", "?id=TESTSTATION&baseStart=abc", "?id=TESTSTATION&completeness=maybe"} {
+		req := httptest.NewRequest(http.MethodGet, "/station/indices"+query, nil)
+		rec := httptest.NewRecorder()
+		indicesHandler(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%q: expected 400, got %d", query, rec.Code)
+		}
+	}
+}
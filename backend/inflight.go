@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// fetchGroup lets concurrent loads of the same station share one call
+type fetchGroup struct {
+	mu    sync.Mutex
+	calls map[string]*fetchCall
+	// number of callers that waited for another caller's load
+	coalesced uint64
+}
+
+type fetchCall struct {
+	done chan struct{}
+	data *stationData
+	err  error
+}
+
+var fetches = &fetchGroup{calls: make(map[string]*fetchCall)}
+
+// do runs load once for all concurrent callers with the same id and hands
+// everyone its result or error.
+func (g *fetchGroup) do(id string, load func() (*stationData, error)) (*stationData, error) {
+	g.mu.Lock()
+	if c, ok := g.calls[id]; ok {
+		g.coalesced++
+		g.mu.Unlock()
+		<-c.done
+		return c.data, c.err
+	}
+	c := &fetchCall{done: make(chan struct{})}
+	g.calls[id] = c
+	g.mu.Unlock()
+
+	finished := false
+	defer func() {
+		// a panicking load must not leave the waiters without an error
+		if !finished {
+			c.err = fmt.Errorf("Laden der Station %s abgebrochen", id)
+		}
+		g.mu.Lock()
+		delete(g.calls, id)
+		g.mu.Unlock()
+		close(c.done)
+	}()
+
+	c.data, c.err = load()
+	finished = true
+	return c.data, c.err
+}
+
+func (g *fetchGroup) coalescedCount() uint64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.coalesced
+}
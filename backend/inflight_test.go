@@ -0,0 +1,151 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// setupFetches resets the global fetch group for testing.
+func setupFetches(t *testing.T) {
+	oldFetches := fetches
+	fetches = &fetchGroup{calls: make(map[string]*fetchCall)}
+	t.Cleanup(func() {
+		fetches = oldFetches
+	})
+}
+
+// blockingServer answers station requests with status once release is closed
+func blockingServer(status int, release chan struct{}, requests *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+		if status != http.StatusOK {
+			http.Error(w, "not found", status)
+			return
+		}
+		w.Write([]byte(`"ID","DATE","ELEMENT","DATA_VALUE","M_FLAG","Q_FLAG","S_FLAG","OBS_TIME"
+"STN001","20200101","TMIN",50,"","","S","0700"
+`))
+	}))
+}
+
+// getConcurrently calls getStationData n times in parallel and releases the
+// server once all but the first caller wait for the running download
+func getConcurrently(t *testing.T, n int, release chan struct{}) ([]*stationData, []error) {
+	t.Helper()
+	results := make([]*stationData, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = getStationData("STN001")
+		}()
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for fetches.coalescedCount() < uint64(n-1) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	return results, errs
+}
+
+func TestGetStationData_CoalescesConcurrentMisses(t *testing.T) {
+	setupCache(t)
+	setupFetches(t)
+	var requests atomic.Int32
+	release := make(chan struct{})
+	server := blockingServer(http.StatusOK, release, &requests)
+	defer server.Close()
+	setupSource(t, &httpSource{baseURL: server.URL})
+
+	results, errs := getConcurrently(t, 10, release)
+	for i := range results {
+		if errs[i] != nil || results[i].len() != 1 || allRows(results[i])[0].Value != 50 {
+			t.Errorf("caller %d: unexpected result %+v %v", i, results[i], errs[i])
+		}
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("expected 1 download, got %d", n)
+	}
+	if n := fetches.coalescedCount(); n != 9 {
+		t.Errorf("expected 9 coalesced callers, got %d", n)
+	}
+	if len(fetches.calls) != 0 {
+		t.Error("expected no call in flight afterwards")
+	}
+}
+
+func TestGetStationData_CoalescedErrorIsShared(t *testing.T) {
+	setupCache(t)
+	setupFetches(t)
+	var requests atomic.Int32
+	release := make(chan struct{})
+	server := blockingServer(http.StatusNotFound, release, &requests)
+	defer server.Close()
+	setupSource(t, &httpSource{baseURL: server.URL})
+
+	_, errs := getConcurrently(t, 5, release)
+	for i, err := range errs {
+		if err == nil {
+			t.Errorf("caller %d: expected error", i)
+		}
+	}
+	// one download tries the compressed and the plain file
+	if n := requests.Load(); n != 2 {
+		t.Errorf("expected 2 requests for one download, got %d", n)
+	}
+
+	// errors are not cached, the next request tries again
+	if _, err := getStationData("STN001"); err == nil {
+		t.Error("expected error")
+	}
+	if n := requests.Load(); n != 4 {
+		t.Errorf("expected 4 requests for two downloads, got %d", n)
+	}
+}
+
+func TestFetchGroup_PanicReleasesWaiters(t *testing.T) {
+	g := &fetchGroup{calls: make(map[string]*fetchCall)}
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	go func() {
+		defer func() { recover() }()
+		g.do("STN001", func() (*stationData, error) {
+			close(started)
+			<-release
+			panic("boom")
+		})
+	}()
+	<-started
+
+	done := make(chan error)
+	go func() {
+		_, err := g.do("STN001", func() (*stationData, error) { return nil, nil })
+		done <- err
+	}()
+	for g.coalescedCount() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("expected an error for the waiter")
+		}
+		if n := g.coalescedCount(); n != 1 {
+			t.Errorf("expected the second caller to share the call, got %d coalesced", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("waiter was not released")
+	}
+}
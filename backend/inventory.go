@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// ElementCoverage is the inventory record of one element. Coverage is the
+// share of the requested start–end years within FirstYear–LastYear in percent.
+type ElementCoverage struct {
+	Element   string   `json:"element"`
+	FirstYear int      `json:"firstYear"`
+	LastYear  int      `json:"lastYear"`
+	Coverage  *float64 `json:"coverage,omitempty"`
+}
+
+type StationInventoryResponse struct {
+	ID        string             `json:"id"`
+	StartYear *int               `json:"startYear,omitempty"`
+	EndYear   *int               `json:"endYear,omitempty"`
+	Elements  []*ElementCoverage `json:"elements"`
+}
+
+// yearCoverage returns how many percent of start–end lie within first–last
+func yearCoverage(first int, last int, startYear int, endYear int) float64 {
+	overlap := min(last, endYear) - max(first, startYear) + 1
+	if overlap <= 0 {
+		return 0
+	}
+	return math.Round(float64(overlap)/float64(endYear-startYear+1)*1000) / 10
+}
+
+// inventoryCoverage lists the elements of the inventory in the order of
+// supportedElements; with a window the coverage of start–end is added.
+func inventoryCoverage(inv *StationInventory, window bool, startYear int, endYear int) []*ElementCoverage {
+	elements := []*ElementCoverage{}
+	for _, element := range supportedElements {
+		e, ok := inv.Elements[element]
+		if !ok {
+			continue
+		}
+		ec := &ElementCoverage{Element: element, FirstYear: e.FirstYear, LastYear: e.LastYear}
+		if window {
+			coverage := yearCoverage(e.FirstYear, e.LastYear, startYear, endYear)
+			ec.Coverage = &coverage
+		}
+		elements = append(elements, ec)
+	}
+	return elements
+}
+
+// inventoryHandler serves /station/inventory?id=...&start=...&end=...
+// start and end are optional but have to be given together.
+func inventoryHandler(w http.ResponseWriter, r *http.Request) {
+	//cors handling
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+	q := r.URL.Query()
+	id := q.Get("id")
+	startStr := q.Get("start")
+	endStr := q.Get("end")
+	enc := json.NewEncoder(w)
+
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		response := Response{Data: nil, ErrorMsg: "Please provide a valid station ID."}
+		enc.Encode(response)
+		return
+	}
+
+	window := startStr != "" || endStr != ""
+	var startYear, endYear int
+	if window {
+		var errStart, errEnd error
+		startYear, errStart = strconv.Atoi(startStr)
+		endYear, errEnd = strconv.Atoi(endStr)
+		if errStart != nil || errEnd != nil || endYear < startYear {
+			w.WriteHeader(http.StatusBadRequest)
+			response := Response{Data: nil, ErrorMsg: "Please provide a valid start and end year."}
+			enc.Encode(response)
+			return
+		}
+	}
+
+	inv, exists := inventoryMap[id]
+	if !exists {
+		w.WriteHeader(http.StatusNotFound)
+		response := Response{Data: nil, ErrorMsg: fmt.Sprintf("No inventory found for station %s.", id)}
+		enc.Encode(response)
+		return
+	}
+
+	inventory := StationInventoryResponse{ID: id, Elements: inventoryCoverage(inv, window, startYear, endYear)}
+	if window {
+		inventory.StartYear = &startYear
+		inventory.EndYear = &endYear
+	}
+	response := Response{Data: inventory, ErrorMsg: ""}
+	enc.Encode(response)
+}
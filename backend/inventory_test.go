@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStationInventory_CoversEveryElement(t *testing.T) {
+	// TMAX since 1900 but TMIN only since 1990
+	inv := &StationInventory{Elements: map[string]*ElementInventory{
+		"TMAX": {FirstYear: 1900, LastYear: 2023},
+		"TMIN": {FirstYear: 1990, LastYear: 2023},
+		"PRCP": {FirstYear: 1900, LastYear: 2023},
+	}}
+
+	tests := []struct {
+		name     string
+		start    int
+		end      int
+		elements []string
+		want     bool
+	}{
+		{"default elements before TMIN starts", 1950, 2020, nil, false},
+		{"default elements after TMIN starts", 1990, 2020, nil, true},
+		{"TMAX only", 1950, 2020, []string{"TMAX"}, true},
+		{"TMAX and TMIN", 1950, 2020, []string{"TMAX", "TMIN"}, false},
+		{"PRCP", 1900, 2023, []string{"PRCP"}, true},
+		{"after the last year", 1990, 2024, []string{"PRCP"}, false},
+		{"missing element", 1990, 2020, []string{"SNOW"}, false},
+	}
+	for _, tc := range tests {
+		if got := inv.covers(tc.start, tc.end, tc.elements); got != tc.want {
+			t.Errorf("%s: covers = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	if !inv.hasElements(nil) || inv.hasElements([]string{"SNWD"}) {
+		t.Error("expected TMIN/TMAX to be present and SNWD to be missing")
+	}
+	rain := &StationInventory{Elements: map[string]*ElementInventory{"PRCP": {FirstYear: 1900, LastYear: 2023}}}
+	if rain.hasElements(nil) {
+		t.Error("expected a precipitation-only station to lack the default elements")
+	}
+}
+
+func TestYearCoverage(t *testing.T) {
+	tests := []struct {
+		first, last, start, end int
+		want                    float64
+	}{
+		{1900, 2023, 1950, 2020, 100},
+		{1990, 2023, 1981, 2020, 77.5},
+		{1990, 2000, 2001, 2020, 0},
+		{1950, 1950, 1950, 1950, 100},
+	}
+	for _, tc := range tests {
+		if got := yearCoverage(tc.first, tc.last, tc.start, tc.end); !approxEqual(got, tc.want, 0.001) {
+			t.Errorf("yearCoverage(%d, %d, %d, %d) = %v, want %v", tc.first, tc.last, tc.start, tc.end, got, tc.want)
+		}
+	}
+}
+
+func TestInventoryHandler(t *testing.T) {
+	setupGlobalState(t, []*Station{}, map[string]*StationInventory{
+		"STN001": {Elements: map[string]*ElementInventory{
+			"PRCP": {FirstYear: 1900, LastYear: 2023},
+			"TMAX": {FirstYear: 1900, LastYear: 2023},
+			"TMIN": {FirstYear: 1990, LastYear: 2023},
+		}},
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/station/inventory?id=STN001&start=1981&end=2020", nil)
+	rec := httptest.NewRecorder()
+	inventoryHandler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var resp struct {
+		Data     StationInventoryResponse `json:"data"`
+		ErrorMsg string                   `json:"errorMessage"`
+	}
+	json.NewDecoder(rec.Body).Decode(&resp)
+	elements := resp.Data.Elements
+	if len(elements) != 3 || elements[0].Element != "TMIN" || elements[1].Element != "TMAX" || elements[2].Element != "PRCP" {
+		t.Fatalf("expected TMIN, TMAX, PRCP, got %+v", elements)
+	}
+	if elements[0].FirstYear != 1990 || elements[0].Coverage == nil || *elements[0].Coverage != 77.5 {
+		t.Errorf("unexpected TMIN record %+v", elements[0])
+	}
+	if *elements[1].Coverage != 100 {
+		t.Errorf("expected full TMAX coverage, got %v", *elements[1].Coverage)
+	}
+
+	// without a window no coverage is reported
+	req = httptest.NewRequest(http.MethodGet, "/station/inventory?id=STN001", nil)
+	rec = httptest.NewRecorder()
+	inventoryHandler(rec, req)
+	var plain struct {
+		Data StationInventoryResponse `json:"data"`
+	}
+	json.NewDecoder(rec.Body).Decode(&plain)
+	if plain.Data.StartYear != nil || plain.Data.Elements[0].Coverage != nil {
+		t.Errorf("expected no coverage without start/end, got %+v", plain.Data)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/station/inventory?id=UNKNOWN", nil)
+	rec = httptest.NewRecorder()
+	inventoryHandler(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown station, got %d", rec.Code)
+	}
+
+	for _, query := range []string{"", "?id=STN001&start=1990", "?id=STN001&start=2000&end=1990", "?id=STN001&start=abc&end=2000"} {
+		req := httptest.NewRequest(http.MethodGet, "/station/inventory"+query, nil)
+		rec := httptest.NewRecorder()
+		inventoryHandler(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%q: expected 400, got %d", query, rec.Code)
+		}
+	}
+}
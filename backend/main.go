@@ -3,16 +3,16 @@ package main
 //loading libaries
 import (
 	"bufio"
-	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"math"
+	"math/bits"
 	"net/http"
+	"net/url"
 	"slices"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 )
 
@@ -22,16 +22,26 @@ type Response struct {
 }
 
 // internal memory for each line
+// flags are the single letter GHCN measurement, quality and source flags (0 if blank)
 type RawStationData struct {
 	Date        time.Time
 	ElementType string
 	Value       int
+	MFlag       byte
+	QFlag       byte
+	SFlag       byte
 }
 
+// temperatures in °C, prcp and snow are totals in mm, snwd is the mean snow depth in mm
 type AnnualStationData struct {
 	Year int      `json:"year"`
 	TMin *float64 `json:"tmin"`
 	TMax *float64 `json:"tmax"`
+	Prcp *float64 `json:"prcp"`
+	Snow *float64 `json:"snow"`
+	Snwd *float64 `json:"snwd"`
+	// percentage of days with an observation, per element
+	Coverage map[string]float64 `json:"coverage,omitempty"`
 }
 
 type SeasonalStationData struct {
@@ -39,11 +49,53 @@ type SeasonalStationData struct {
 	Season string   `json:"season"`
 	TMin   *float64 `json:"tmin"`
 	TMax   *float64 `json:"tmax"`
+	Prcp   *float64 `json:"prcp"`
+	Snow   *float64 `json:"snow"`
+	Snwd   *float64 `json:"snwd"`
+	// percentage of days with an observation, per element
+	Coverage map[string]float64 `json:"coverage,omitempty"`
+}
+
+// monthly means (temperature, snow depth) and totals (prcp, snow) with the
+// number of daily observations per element
+type MonthlyStationData struct {
+	Year      int      `json:"year"`
+	Month     int      `json:"month"`
+	TMin      *float64 `json:"tmin"`
+	TMax      *float64 `json:"tmax"`
+	Prcp      *float64 `json:"prcp"`
+	Snow      *float64 `json:"snow"`
+	Snwd      *float64 `json:"snwd"`
+	TMinCount int      `json:"tminCount"`
+	TMaxCount int      `json:"tmaxCount"`
+	PrcpCount int      `json:"prcpCount"`
+	SnowCount int      `json:"snowCount"`
+	SnwdCount int      `json:"snwdCount"`
+}
+
+// single daily value, converted into °C / mm
+type DailyObservation struct {
+	Date    string  `json:"date"`
+	Element string  `json:"element"`
+	Value   float64 `json:"value"`
+	MFlag   string  `json:"mflag,omitempty"`
+	QFlag   string  `json:"qflag,omitempty"`
+	SFlag   string  `json:"sflag,omitempty"`
+}
+
+type DailyStationResponse struct {
+	Total        int                 `json:"total"`
+	Offset       int                 `json:"offset"`
+	Limit        int                 `json:"limit"`
+	Observations []*DailyObservation `json:"observations"`
 }
 
 type StationDetailResponse struct {
 	Annual   []*AnnualStationData   `json:"annual,omitempty"`
 	Seasonal []*SeasonalStationData `json:"seasonal,omitempty"`
+	// set if the values are deviations from a reference period
+	Anomaly  *AnomalyReference `json:"anomaly,omitempty"`
+	Analysis *TrendAnalysis    `json:"analysis,omitempty"`
 }
 
 type Station struct {
@@ -51,10 +103,32 @@ type Station struct {
 	Name      string   `json:"name,omitempty"`
 	Latitude  *float64 `json:"latitude,omitempty"`
 	Longitude *float64 `json:"longitude,omitempty"`
-	Distance  float64  `json:"distance"`
+	Elevation *float64 `json:"elevation,omitempty"`
+	State     string   `json:"state,omitempty"`
+	StateName string   `json:"stateName,omitempty"`
+	// FIPS country code, the first two characters of the ID
+	Country     string   `json:"country,omitempty"`
+	CountryName string   `json:"countryName,omitempty"`
+	Networks    []string `json:"networks,omitempty"`
+	WMOID       string   `json:"wmoId,omitempty"`
+	Distance    float64  `json:"distance"`
+}
+
+// networks a station can belong to (GCOS Surface Network, US Historical
+// Climatology Network, US Climate Reference Network)
+var supportedNetworks = []string{"GSN", "HCN", "CRN"}
+
+// inNetwork reports whether the station belongs to the network
+func (s *Station) inNetwork(network string) bool {
+	return slices.Contains(s.Networks, network)
 }
 
 type StationInventory struct {
+	// year range of every supported element the station reports
+	Elements map[string]*ElementInventory
+}
+
+type ElementInventory struct {
 	FirstYear int
 	LastYear  int
 }
@@ -62,62 +136,303 @@ type StationInventory struct {
 var inventoryMap = make(map[string]*StationInventory)
 var allStations []*Station
 
-// station data cache
-const (
-	cacheTTL = 1 * time.Hour
-)
+// GHCN elements parsed from the station files and the inventory
+var supportedElements = []string{"TMIN", "TMAX", "PRCP", "SNOW", "SNWD"}
 
-var baseURL = "https://noaa-ghcn-pds.s3.amazonaws.com/csv/by_station"
+// elements a station needs when no elements are requested
+var defaultElements = []string{"TMIN", "TMAX"}
 
-type cacheEntry struct {
-	data      []RawStationData
-	fetchedAt time.Time
+func isSupportedElement(element string) bool {
+	return slices.Contains(supportedElements, element)
 }
 
-type stationCache struct {
-	mu      sync.RWMutex
-	entries map[string]cacheEntry
+// isTotalElement returns true for elements that are summed up over a period
+// (precipitation, snowfall) instead of being averaged.
+func isTotalElement(element string) bool {
+	return element == "PRCP" || element == "SNOW"
 }
 
-var cache = &stationCache{entries: make(map[string]cacheEntry)}
+// elementScale returns the divisor converting raw GHCN values into °C or mm.
+// TMIN, TMAX and PRCP are stored in tenths, SNOW and SNWD already in mm.
+func elementScale(element string) float64 {
+	switch element {
+	case "TMIN", "TMAX", "PRCP":
+		return 10
+	}
+	return 1
+}
 
-// getStationData returns station data from cache if available and not expired,
-// otherwise fetches from S3 and caches the result.
-func getStationData(id string) ([]RawStationData, error) {
-	cache.mu.RLock()
-	entry, exists := cache.entries[id]
-	cache.mu.RUnlock()
+// parseElements parses a comma separated element list like "TMIN,PRCP".
+func parseElements(s string) ([]string, error) {
+	var elements []string
+	if s == "" {
+		return elements, nil
+	}
+	for _, e := range strings.Split(s, ",") {
+		e = strings.ToUpper(strings.TrimSpace(e))
+		if !isSupportedElement(e) {
+			return nil, fmt.Errorf("unknown element %q", e)
+		}
+		if !slices.Contains(elements, e) {
+			elements = append(elements, e)
+		}
+	}
+	return elements, nil
+}
 
-	if exists && time.Since(entry.fetchedAt) < cacheTTL {
-		return entry.data, nil
+// covers reports whether the station has data for the whole start–end range.
+// Every requested element (default TMIN and TMAX) needs its own record
+// covering the range.
+func (inv *StationInventory) covers(startYear int, endYear int, elements []string) bool {
+	if len(elements) == 0 {
+		elements = defaultElements
+	}
+	for _, element := range elements {
+		e, ok := inv.Elements[element]
+		if !ok || e.FirstYear > startYear || e.LastYear < endYear {
+			return false
+		}
 	}
+	return true
+}
 
-	data, err := loadStationData(baseURL, id)
-	if err != nil {
-		return nil, err
+// hasElements reports whether the station reports all given elements,
+// regardless of the years. Without elements TMIN and TMAX are required.
+func (inv *StationInventory) hasElements(elements []string) bool {
+	if len(elements) == 0 {
+		elements = defaultElements
+	}
+	for _, element := range elements {
+		if _, ok := inv.Elements[element]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// completenessRules decide whether a month has enough daily values to be used
+// and how many usable months a year or season needs to get a mean.
+type completenessRules struct {
+	MaxMissingDays        int // per month
+	MaxConsecutiveMissing int // per month
+	MinMonthsPerYear      int
+	MinMonthsPerSeason    int
+}
+
+// WMO recommendation: a month may miss at most 10 days, 5 of them in a row,
+// and a year (season) needs all of its months.
+var defaultCompleteness = completenessRules{
+	MaxMissingDays:        10,
+	MaxConsecutiveMissing: 5,
+	MinMonthsPerYear:      12,
+	MinMonthsPerSeason:    3,
+}
+
+// noCompleteness accepts every month with at least one observation
+var noCompleteness = completenessRules{
+	MaxMissingDays:        31,
+	MaxConsecutiveMissing: 31,
+	MinMonthsPerYear:      1,
+	MinMonthsPerSeason:    1,
+}
+
+// parseCompleteness reads the completeness query parameters. completeness=false
+// disables the rules, the other parameters override single WMO defaults.
+func parseCompleteness(q url.Values) (completenessRules, error) {
+	rules := defaultCompleteness
+	if s := q.Get("completeness"); s != "" {
+		enabled, err := strconv.ParseBool(s)
+		if err != nil {
+			return rules, fmt.Errorf("invalid completeness value %q", s)
+		}
+		if !enabled {
+			rules = noCompleteness
+		}
+	}
+
+	params := []struct {
+		name     string
+		field    *int
+		min, max int
+	}{
+		{"maxMissingDays", &rules.MaxMissingDays, 0, 31},
+		{"maxConsecutiveMissing", &rules.MaxConsecutiveMissing, 0, 31},
+		{"minMonths", &rules.MinMonthsPerYear, 1, 12},
+		{"minSeasonMonths", &rules.MinMonthsPerSeason, 1, 3},
+	}
+	for _, p := range params {
+		s := q.Get(p.name)
+		if s == "" {
+			continue
+		}
+		val, err := strconv.Atoi(s)
+		if err != nil || val < p.min || val > p.max {
+			return rules, fmt.Errorf("%s must be between %d and %d", p.name, p.min, p.max)
+		}
+		*p.field = val
+	}
+	return rules, nil
+}
+
+// Q-flags of values that failed one of NOAA's quality checks (see GHCN-Daily readme)
+const qualityFlags = "DGIKLMNORSTWXZ"
+
+// qcFilter decides which quality-flagged values are used in the calculations.
+// By default every value carrying a Q-flag is dropped.
+type qcFilter struct {
+	includeFlagged bool   // keep all values regardless of their Q-flag
+	excludeFlags   string // if set, drop only values with one of these Q-flags
+}
+
+func (f qcFilter) accept(qflag byte) bool {
+	if f.includeFlagged || qflag == 0 {
+		return true
 	}
+	if f.excludeFlags != "" {
+		return !strings.ContainsRune(f.excludeFlags, rune(qflag))
+	}
+	return false
+}
+
+// applyQCFilter drops the values rejected by the filter. The input data is
+// returned unchanged if nothing has to be removed.
+func applyQCFilter(data *stationData, f qcFilter) *stationData {
+	if f.includeFlagged {
+		return data
+	}
+	return data.filter(func(r flagRun) bool { return f.accept(r.q) })
+}
+
+// parseQCFilter reads the includeFlagged and qflags query parameters,
+// e.g. includeFlagged=true or qflags=D,G to only drop duplicates and gap check failures.
+func parseQCFilter(q url.Values) (qcFilter, error) {
+	var f qcFilter
+	if s := q.Get("includeFlagged"); s != "" {
+		include, err := strconv.ParseBool(s)
+		if err != nil {
+			return f, fmt.Errorf("invalid includeFlagged value %q", s)
+		}
+		f.includeFlagged = include
+	}
+	for _, flag := range strings.Split(q.Get("qflags"), ",") {
+		flag = strings.ToUpper(strings.TrimSpace(flag))
+		if flag == "" {
+			continue
+		}
+		if len(flag) != 1 || !strings.Contains(qualityFlags, flag) {
+			return f, fmt.Errorf("unknown quality flag %q", flag)
+		}
+		f.excludeFlags += flag
+	}
+	return f, nil
+}
 
-	cache.mu.Lock()
-	cache.entries[id] = cacheEntry{data: data, fetchedAt: time.Now()}
-	cache.mu.Unlock()
+// flagString converts a stored flag into its JSON representation
+func flagString(flag byte) string {
+	if flag == 0 {
+		return ""
+	}
+	return string(rune(flag))
+}
+
+// pagination of the daily endpoint
+const (
+	defaultDailyLimit = 1000
+	maxDailyLimit     = 10000
+)
+
+// station data cache
+const (
+	cacheTTL = 1 * time.Hour
+	// how long stale data is served while it is revalidated
+	cacheStaleTTL = 24 * time.Hour
+)
+
+// getStationData returns station data from cache if available and not expired,
+// otherwise fetches from S3 and caches the result. Stale data is returned
+// right away and revalidated in the background.
+func getStationData(id string) (*stationData, error) {
+	data, ok := cache.get(id)
+	if !ok {
+		//concurrent misses of the same station share one download
+		var err error
+		data, err = fetches.do(id, func() (*stationData, error) {
+			//another request may have filled the cache in the meantime
+			if data, ok := cache.peek(id); ok {
+				return data, nil
+			}
 
+			//checking the disk cache before downloading
+			if disk != nil {
+				if data, version, fetchedAt, ok := disk.get(id); ok {
+					cache.put(id, data, version, fetchedAt)
+					coverageIndex.set(id, buildCoverage(data))
+					return data, nil
+				}
+			}
+
+			data, version, err := loadStationData(source, id, stationVersion{})
+			if err != nil {
+				return nil, err
+			}
+			storeStationData(id, data, version, time.Now())
+			return data, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if stale, version, ok := cache.claimRevalidation(id); ok {
+		go revalidateStation(id, stale, version)
+	}
 	return data, nil
 }
 
+// revalidateStation asks the source whether the station file has changed
+// since version and replaces the cached data if it has
+func revalidateStation(id string, data *stationData, version stationVersion) {
+	fresh, newVersion, err := loadStationData(source, id, version)
+	switch {
+	case errors.Is(err, errNotModified):
+		now := time.Now()
+		cache.refresh(id, now)
+		if disk != nil {
+			if err := disk.put(id, data, version, now); err != nil {
+				fmt.Printf("Cache-Fehler: %v\n", err)
+			}
+		}
+	case err != nil:
+		cache.endRevalidation(id)
+		//no log line per request while the circuit is open
+		if !errors.Is(err, errSourceUnavailable) {
+			fmt.Printf("Fehler beim Aktualisieren von %s: %v\n", id, err)
+		}
+	default:
+		storeStationData(id, fresh, newVersion, time.Now())
+	}
+}
+
+// storeStationData puts downloaded data into the memory and disk cache
+func storeStationData(id string, data *stationData, version stationVersion, fetchedAt time.Time) {
+	cache.put(id, data, version, fetchedAt)
+	coverageIndex.set(id, buildCoverage(data))
+	if disk != nil {
+		if err := disk.put(id, data, version, fetchedAt); err != nil {
+			fmt.Printf("Cache-Fehler: %v\n", err)
+		}
+	}
+}
+
 // loading the inventory file on start up
 func loadInventory() error {
-	url := "https://noaa-ghcn-pds.s3.amazonaws.com/ghcnd-inventory.txt"
-	resp, err := http.Get(url)
+	body, err := source.open("ghcnd-inventory.txt")
 	if err != nil {
-		return fmt.Errorf("Netzwerkfehler: %v", err)
+		return err
 	}
-	defer resp.Body.Close()
+	defer body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("Datei %s nicht gefunden (Status %d)", url, resp.StatusCode)
-	}
-
-	scanner := bufio.NewScanner(resp.Body)
+	scanner := bufio.NewScanner(body)
 	for scanner.Scan() {
 		line := scanner.Text()
 		if len(line) < 45 {
@@ -125,7 +440,7 @@ func loadInventory() error {
 		}
 
 		element := strings.TrimSpace(line[31:35])
-		if element != "TMAX" && element != "TMIN" {
+		if !isSupportedElement(element) {
 			continue
 		}
 
@@ -133,108 +448,206 @@ func loadInventory() error {
 		firstYear, _ := strconv.Atoi(strings.TrimSpace(line[36:40]))
 		lastYear, _ := strconv.Atoi(strings.TrimSpace(line[41:45]))
 
-		if inv, exists := inventoryMap[id]; exists {
-			if firstYear < inv.FirstYear {
-				inv.FirstYear = firstYear
-			}
-			if lastYear > inv.LastYear {
-				inv.LastYear = lastYear
-			}
-		} else {
-			inventoryMap[id] = &StationInventory{FirstYear: firstYear, LastYear: lastYear}
+		inv, exists := inventoryMap[id]
+		if !exists {
+			inv = &StationInventory{Elements: make(map[string]*ElementInventory)}
+			inventoryMap[id] = inv
 		}
+		inv.Elements[element] = &ElementInventory{FirstYear: firstYear, LastYear: lastYear}
 	}
 	return nil
 }
 
 // loading the stations file on start up
 func initStations() error {
-	url := "https://noaa-ghcn-pds.s3.amazonaws.com/ghcnd-stations.txt"
-
-	resp, err := http.Get(url)
+	body, err := source.open("ghcnd-stations.txt")
 	if err != nil {
-		return fmt.Errorf("Netzwerkfehler: %v", err)
+		return err
 	}
-	defer resp.Body.Close()
+	defer body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("Datei %s nicht gefunden (Status %d)", url, resp.StatusCode)
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		if s := parseStationLine(scanner.Text()); s != nil {
+			s.CountryName = countryNames[s.Country]
+			s.StateName = stateNames[s.State]
+			allStations = append(allStations, s)
+		}
 	}
+	return nil
+}
 
-	scanner := bufio.NewScanner(resp.Body)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if len(line) < 71 {
-			continue
+// missing elevation in ghcnd-stations.txt
+const missingElevation = -999.9
+
+// parseStationLine parses a line of ghcnd-stations.txt, nil if it is too short.
+//
+//	ID 1-11, LATITUDE 13-20, LONGITUDE 22-30, ELEVATION 32-37, STATE 39-40,
+//	NAME 42-71, GSN FLAG 73-75, HCN/CRN FLAG 77-79, WMO ID 81-85
+func parseStationLine(line string) *Station {
+	if len(line) < 41 {
+		return nil
+	}
+	field := func(start int, end int) string {
+		if start >= len(line) {
+			return ""
 		}
+		return strings.TrimSpace(line[start:min(end, len(line))])
+	}
 
-		//parsing the information from ghcnd-stations.txt
-		id := strings.TrimSpace(line[0:11])
-		latStr := strings.TrimSpace(line[12:20])
-		longStr := strings.TrimSpace(line[21:30])
-		name := strings.TrimSpace(line[38:71])
+	lat, _ := strconv.ParseFloat(field(12, 20), 64)
+	long, _ := strconv.ParseFloat(field(21, 30), 64)
+
+	//storing basisdata, distance remains unset -> will be calculated later
+	s := &Station{
+		ID:        field(0, 11),
+		Name:      field(41, 71),
+		Latitude:  &lat,
+		Longitude: &long,
+		State:     field(38, 40),
+		Country:   field(0, 2),
+		WMOID:     field(80, 85),
+	}
+	if elev, err := strconv.ParseFloat(field(31, 37), 64); err == nil && elev != missingElevation {
+		s.Elevation = &elev
+	}
+	for _, network := range []string{field(72, 75), field(76, 79)} {
+		if slices.Contains(supportedNetworks, network) {
+			s.Networks = append(s.Networks, network)
+		}
+	}
+	return s
+}
 
-		lat, _ := strconv.ParseFloat(latStr, 64)
-		long, _ := strconv.ParseFloat(longStr, 64)
+// stationFilter holds the criteria a station has to meet besides its location
+type stationFilter struct {
+	StartYear int
+	EndYear   int
+	// elements that must all be available in the years (default TMIN/TMAX)
+	Elements     []string
+	MinElevation *float64
+	MaxElevation *float64
+	// networks the station must all belong to
+	Networks []string
+	// country codes, the station must be in one of them
+	Countries []string
+	// share of days with data in the years, 0 disables the check
+	MinCoverage float64
+}
 
-		//storing basisdata, distance remains unset -> will be calculated later
-		s := &Station{
-			ID:        id,
-			Name:      name,
-			Latitude:  &lat,
-			Longitude: &long,
+// matchesMetadata checks elevation, networks and country
+func (f stationFilter) matchesMetadata(s *Station) bool {
+	if f.MinElevation != nil || f.MaxElevation != nil {
+		if s.Elevation == nil {
+			return false
+		}
+		if f.MinElevation != nil && *s.Elevation < *f.MinElevation {
+			return false
+		}
+		if f.MaxElevation != nil && *s.Elevation > *f.MaxElevation {
+			return false
 		}
-		allStations = append(allStations, s)
 	}
-	return nil
+	for _, network := range f.Networks {
+		if !s.inNetwork(network) {
+			return false
+		}
+	}
+	if len(f.Countries) > 0 && !slices.Contains(f.Countries, s.Country) {
+		return false
+	}
+	return true
 }
 
-// searching for specific stations on given input variables
-func findStations(latUsr float64, longUsr float64, radius int, limit int, startYear int, endYear int) ([]*Station, error) {
-	var stations []*Station
+// matches checks the metadata and if the inventory covers the years
+func (f stationFilter) matches(s *Station) bool {
+	inv, exists := inventoryMap[s.ID]
+	return exists && inv.covers(f.StartYear, f.EndYear, f.Elements) && f.matchesMetadata(s)
+}
 
-	const earthRadius = 6371.0
-	const p = math.Pi / 180
+// matchesIgnoringYears checks the metadata and if the elements are in the inventory at all
+func (f stationFilter) matchesIgnoringYears(s *Station) bool {
+	inv, exists := inventoryMap[s.ID]
+	return exists && inv.hasElements(f.Elements) && f.matchesMetadata(s)
+}
 
-	for _, s := range allStations {
-		if s.Latitude == nil || s.Longitude == nil {
+// parseStationFilter reads elements, minElevation, maxElevation, network and
+// country (both comma separated) and minCoverage from the query, the years
+// are set by the caller.
+// The error message is meant for the user.
+func parseStationFilter(q url.Values) (stationFilter, error) {
+	var f stationFilter
+	elements, err := parseElements(q.Get("elements"))
+	if err != nil {
+		return f, errors.New("Please provide valid elements (TMIN, TMAX, PRCP, SNOW, SNWD).")
+	}
+	f.Elements = elements
+
+	for _, p := range []struct {
+		name  string
+		value **float64
+	}{{"minElevation", &f.MinElevation}, {"maxElevation", &f.MaxElevation}} {
+		str := q.Get(p.name)
+		if str == "" {
 			continue
 		}
+		v, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			return f, fmt.Errorf("Please provide a valid %s in meters.", p.name)
+		}
+		*p.value = &v
+	}
+	if f.MinElevation != nil && f.MaxElevation != nil && *f.MinElevation > *f.MaxElevation {
+		return f, errors.New("Please provide a minElevation below maxElevation.")
+	}
 
-		lat := *s.Latitude
-		long := *s.Longitude
-
-		//calculating distance with haversine formula
-		dLat := (latUsr - lat) * p
-		dLong := (longUsr - long) * p
-
-		a := math.Sin(dLat/2)*math.Sin(dLat/2) +
-			math.Cos(latUsr*p)*math.Cos(lat*p)*
-				math.Sin(dLong/2)*math.Sin(dLong/2)
+	if networks := q.Get("network"); networks != "" {
+		for _, n := range strings.Split(networks, ",") {
+			n = strings.ToUpper(strings.TrimSpace(n))
+			if !slices.Contains(supportedNetworks, n) {
+				return f, errors.New("Please provide valid networks (GSN, HCN, CRN).")
+			}
+			f.Networks = append(f.Networks, n)
+		}
+	}
 
-		distance := earthRadius * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+	if minCoverage := q.Get("minCoverage"); minCoverage != "" {
+		v, err := strconv.ParseFloat(minCoverage, 64)
+		if err != nil || v <= 0 || v > 1 {
+			return f, errors.New("Please provide a minCoverage between 0 and 1.")
+		}
+		f.MinCoverage = v
+	}
 
-		//filtering stations out of radius
-		if distance > float64(radius) {
-			continue
+	if countries := q.Get("country"); countries != "" {
+		for _, c := range strings.Split(countries, ",") {
+			c = strings.ToUpper(strings.TrimSpace(c))
+			if len(c) != 2 {
+				return f, errors.New("Please provide valid country codes (e.g. GM).")
+			}
+			f.Countries = append(f.Countries, c)
 		}
+	}
+	return f, nil
+}
 
+// searching for specific stations on given input variables
+// the stations must match the filter (years, elements, elevation, networks)
+func findStations(latUsr float64, longUsr float64, radius int, limit int, filter stationFilter) ([]*Station, error) {
+	var stations []*Station
+
+	//collecting stations within the radius from the spatial index
+	stationIndex.withinRadius(latUsr, longUsr, float64(radius), func(s *Station, distance float64) {
 		//filtering with inventory file if station has data available in given years
-		inv, exists := inventoryMap[s.ID]
-		if !exists || inv.FirstYear > startYear || inv.LastYear < endYear {
-			continue
+		if !filter.matches(s) {
+			return
 		}
 
-		//adding station to list
-		matchedStation := &Station{
-			ID:        s.ID,
-			Name:      s.Name,
-			Latitude:  s.Latitude,
-			Longitude: s.Longitude,
-			Distance:  distance,
-		}
-		stations = append(stations, matchedStation)
-	}
+		//adding a copy of the station to list
+		matchedStation := *s
+		matchedStation.Distance = distance
+		stations = append(stations, &matchedStation)
+	})
 
 	//sorting the stations list
 	slices.SortFunc(stations, func(a, b *Station) int {
@@ -247,6 +660,11 @@ func findStations(latUsr float64, longUsr float64, radius int, limit int, startY
 		return 0
 	})
 
+	//dropping stations with too many gaps in the years
+	if filter.MinCoverage > 0 {
+		return filterByCoverage(stations, filter, limit)
+	}
+
 	limStations := []*Station{}
 	for i, x := range stations {
 		limStations = append(limStations, x)
@@ -260,37 +678,14 @@ func findStations(latUsr float64, longUsr float64, radius int, limit int, startY
 // countStationsInRadius counts how many stations exist within the given radius,
 // ignoring the year filter. Used to distinguish "no stations nearby" from
 // "stations nearby but none with data in the requested year range".
-func countStationsInRadius(latUsr float64, longUsr float64, radius int) int {
+func countStationsInRadius(latUsr float64, longUsr float64, radius int, filter stationFilter) int {
 	count := 0
-	const earthRadius = 6371.0
-	const p = math.Pi / 180
-
-	for _, s := range allStations {
-		if s.Latitude == nil || s.Longitude == nil {
-			continue
-		}
-
-		// only count stations that have TMIN/TMAX data in the inventory
-		if _, exists := inventoryMap[s.ID]; !exists {
-			continue
-		}
-
-		lat := *s.Latitude
-		long := *s.Longitude
-
-		dLat := (latUsr - lat) * p
-		dLong := (longUsr - long) * p
-
-		a := math.Sin(dLat/2)*math.Sin(dLat/2) +
-			math.Cos(latUsr*p)*math.Cos(lat*p)*
-				math.Sin(dLong/2)*math.Sin(dLong/2)
-
-		distance := earthRadius * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
-
-		if distance <= float64(radius) {
+	stationIndex.withinRadius(latUsr, longUsr, float64(radius), func(s *Station, distance float64) {
+		// only count stations that have the requested data (default TMIN/TMAX) in the inventory
+		if filter.matchesIgnoringYears(s) {
 			count++
 		}
-	}
+	})
 	return count
 }
 
@@ -306,8 +701,26 @@ func stationsHandler(w http.ResponseWriter, r *http.Request) {
 	//cors handling
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+
+	switch r.Method {
+	case http.MethodOptions:
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case http.MethodGet, http.MethodPost:
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
 
 	q := r.URL.Query()
+
+	//bounding box and polygon queries
+	if r.Method == http.MethodPost || q.Has("bbox") {
+		areaStationsHandler(w, r)
+		return
+	}
+
 	latStr := q.Get("lat")
 	longStr := q.Get("long")
 	radiusStr := q.Get("radius")
@@ -394,14 +807,25 @@ func stationsHandler(w http.ResponseWriter, r *http.Request) {
 		enc.Encode(response)
 		return
 	}
+	filter, err := parseStationFilter(q)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := Response{Data: []*Station{}, ErrorMsg: err.Error()}
+		enc.Encode(response)
+		return
+	}
+	filter.StartYear, filter.EndYear = start, end
 
-	stationList, _ := findStations(lat, long, radius, limit, start, end)
+	stationList, err := findStations(lat, long, radius, limit, filter)
 
 	// if no stations matched, check if there are stations in the radius at all
 	// to give the user a more helpful error message.
 	errMsg := ""
-	if len(stationList) == 0 {
-		geoCount := countStationsInRadius(lat, long, radius)
+	if err != nil {
+		//stations with unknown coverage were left out, the list is partial
+		errMsg = err.Error()
+	} else if len(stationList) == 0 {
+		geoCount := countStationsInRadius(lat, long, radius, filter)
 		if geoCount > 0 {
 			errMsg = fmt.Sprintf("There are %d stations within the radius, but none have data for the selected time range (%d–%d). Try adjusting the start/end year.", geoCount, start, end)
 		} else {
@@ -413,139 +837,260 @@ func stationsHandler(w http.ResponseWriter, r *http.Request) {
 	enc.Encode(response)
 }
 
-func loadStationData(baseURL string, id string) ([]RawStationData, error) {
-	url := fmt.Sprintf("%s/%s.csv", baseURL, id)
+// loadStationData downloads and parses the station CSV. With a known prev
+// version it returns errNotModified if the file has not changed.
+func loadStationData(src dataSource, id string, prev stationVersion) (*stationData, stationVersion, error) {
+	body, version, err := src.openStation(id, prev)
+	if err != nil {
+		return nil, version, err
+	}
+	defer body.Close()
 
-	resp, err := http.Get(url)
+	data, err := parseStationCSV(body)
 	if err != nil {
-		return nil, fmt.Errorf("Netzwerkfehler: %v", err)
+		return nil, version, err
+	}
+	return data, version, nil
+}
+
+// elementAggr accumulates the daily values of one element within a month
+type elementAggr struct {
+	sum, count int
+	days       uint32 // bit d-1 is set if day d has an observation
+}
+
+// monthAggr holds the aggregated daily values of all elements of one month
+type monthAggr struct {
+	year     int
+	month    time.Month
+	elements map[string]*elementAggr
+}
+
+func newMonthAggr(year int, month time.Month) *monthAggr {
+	return &monthAggr{year: year, month: month, elements: make(map[string]*elementAggr)}
+}
+
+// add counts the value of the element observed on day dom of the month
+func (m *monthAggr) add(element string, dom int, value int) {
+	e, ok := m.elements[element]
+	if !ok {
+		e = &elementAggr{}
+		m.elements[element] = e
+	}
+	e.sum += value
+	e.count++
+	e.days |= 1 << (dom - 1)
+}
+
+// count returns the number of daily observations of the element
+func (m *monthAggr) count(element string) int {
+	if e, ok := m.elements[element]; ok {
+		return e.count
 	}
-	defer resp.Body.Close()
+	return 0
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("Station %s nicht gefunden (Status %d)", id, resp.StatusCode)
+// observedDays returns the number of distinct days with an observation
+func (m *monthAggr) observedDays(element string) int {
+	if e, ok := m.elements[element]; ok {
+		return bits.OnesCount32(e.days)
 	}
+	return 0
+}
 
-	reader := csv.NewReader(resp.Body)
-	var dataList []RawStationData
-	const layout = "20060102"
+// value returns the monthly mean of the element in raw units, or the monthly
+// total for precipitation and snowfall.
+func (m *monthAggr) value(element string) (float64, bool) {
+	e, ok := m.elements[element]
+	if !ok || e.count == 0 {
+		return 0, false
+	}
+	if isTotalElement(element) {
+		return float64(e.sum), true
+	}
+	return float64(e.sum) / float64(e.count), true
+}
 
-	_, _ = reader.Read()
+// unitValue returns the monthly value in °C / mm, nil without observations
+func (m *monthAggr) unitValue(element string) *float64 {
+	val, ok := m.value(element)
+	if !ok {
+		return nil
+	}
+	return toUnit(val, element)
+}
 
-	for {
-		line, err := reader.Read()
-		if err == io.EOF {
-			break
-		}
-		if err != nil || len(line) < 4 {
+// complete reports whether the element has enough days in this month
+// to pass the completeness rules.
+func (m *monthAggr) complete(element string, rules completenessRules) bool {
+	e, ok := m.elements[element]
+	if !ok || e.count == 0 {
+		return false
+	}
+	days := daysIn(m.year, m.month)
+	if days-bits.OnesCount32(e.days) > rules.MaxMissingDays {
+		return false
+	}
+	// longest run of consecutive missing days
+	run, longest := 0, 0
+	for d := 0; d < days; d++ {
+		if e.days&(1<<d) != 0 {
+			run = 0
 			continue
 		}
+		run++
+		longest = max(longest, run)
+	}
+	return longest <= rules.MaxConsecutiveMissing
+}
 
-		//filtering for TMIN and TMAX only
-		element := line[2]
-		if element != "TMIN" && element != "TMAX" {
-			continue
+// toUnit converts a raw value into °C / mm, rounded to one decimal
+func toUnit(val float64, element string) *float64 {
+	val = val / elementScale(element)
+	val = math.Round(val*10) / 10
+	return &val
+}
+
+// daysIn returns the number of days of the month
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+type monthKey struct {
+	year  int
+	month time.Month
+}
+
+// aggregateMonths groups the daily values by calendar month
+func aggregateMonths(data *stationData) map[monthKey]*monthAggr {
+	months := make(map[monthKey]*monthAggr)
+	for i, e := range data.series {
+		element := supportedElements[i]
+		var m *monthAggr
+		for j, day := range e.days {
+			year, month, dom := civilDate(day)
+			//the days are sorted, so the month only changes at its end
+			if m == nil || m.year != year || m.month != month {
+				key := monthKey{year: year, month: month}
+				if m = months[key]; m == nil {
+					m = newMonthAggr(year, month)
+					months[key] = m
+				}
+			}
+			m.add(element, dom, int(e.values[j]))
 		}
+	}
+	return months
+}
 
-		date, err := time.Parse(layout, line[1])
-		if err != nil {
+// summarizeMonths combines the monthly aggregates of a period (year or season)
+// into one value. Temperatures and snow depth are the average of the monthly
+// means, precipitation and snowfall the sum of all daily values.
+// Only months passing the completeness rules are used and at least minMonths
+// of them are required. The result is converted to °C / mm and rounded to one decimal.
+func summarizeMonths(months map[time.Month]*monthAggr, element string, minMonths int, rules completenessRules) *float64 {
+	var sum float64
+	var count int
+	for _, m := range months {
+		if !m.complete(element, rules) {
 			continue
 		}
+		val, _ := m.value(element)
+		sum += val
+		count++
+	}
+	if count == 0 || count < minMonths {
+		return nil
+	}
+	if !isTotalElement(element) {
+		sum = sum / float64(count)
+	}
+	return toUnit(sum, element)
+}
 
-		//skipping empty data
-		val, err := strconv.Atoi(line[3])
-		if err != nil || val == -9999 {
-			continue
+// periodCoverage returns the percentage of days of a period (with the given
+// number of days) that have an observation, per element.
+func periodCoverage(months map[time.Month]*monthAggr, periodDays int) map[string]float64 {
+	coverage := make(map[string]float64)
+	for _, element := range supportedElements {
+		observed := 0
+		for _, m := range months {
+			observed += m.observedDays(element)
+		}
+		if observed > 0 {
+			coverage[element] = math.Round(float64(observed)/float64(periodDays)*1000) / 10
 		}
+	}
+	return coverage
+}
 
-		dataList = append(dataList, RawStationData{
-			Date:        date,
-			ElementType: element,
-			Value:       val,
-		})
+// calculateMonthly returns the mean temperatures and precipitation totals per
+// month together with the number of daily observations they are based on.
+func calculateMonthly(data *stationData) []*MonthlyStationData {
+	var result []*MonthlyStationData
+	for key, m := range aggregateMonths(data) {
+		mData := &MonthlyStationData{
+			Year:      key.year,
+			Month:     int(key.month),
+			TMin:      m.unitValue("TMIN"),
+			TMax:      m.unitValue("TMAX"),
+			Prcp:      m.unitValue("PRCP"),
+			Snow:      m.unitValue("SNOW"),
+			Snwd:      m.unitValue("SNWD"),
+			TMinCount: m.count("TMIN"),
+			TMaxCount: m.count("TMAX"),
+			PrcpCount: m.count("PRCP"),
+			SnowCount: m.count("SNOW"),
+			SnwdCount: m.count("SNWD"),
+		}
+		result = append(result, mData)
 	}
-	return dataList, nil
+	slices.SortFunc(result, func(a, b *MonthlyStationData) int {
+		if a.Year != b.Year {
+			return a.Year - b.Year
+		}
+		return a.Month - b.Month
+	})
+	return result
 }
 
-// calculating yearly average for tmin and tmax
+// calculating yearly average for tmin and tmax and yearly totals for precipitation
 // The annual mean is calculated as the average of the monthly means
 // (Jahresmitteltemperatur from Monatsmitteltemperaturen), so that each month
 // contributes equally regardless of how many daily observations it contains.
-func calculateAnnualAvg(rawData []RawStationData) []*AnnualStationData {
-	type MonthAggr struct {
-		sumMin, countMin int
-		sumMax, countMax int
-	}
+// Years without enough complete months get no value, but are still listed
+// together with their coverage.
+func calculateAnnualAvg(data *stationData, rules completenessRules) []*AnnualStationData {
 	// year -> month -> aggregation of daily values
-	monthly := make(map[int]map[time.Month]*MonthAggr)
-
-	for _, d := range rawData {
-		year := d.Date.Year()
-		month := d.Date.Month()
-		if _, ok := monthly[year]; !ok {
-			monthly[year] = make(map[time.Month]*MonthAggr)
-		}
-		if _, ok := monthly[year][month]; !ok {
-			monthly[year][month] = &MonthAggr{}
-		}
-		switch d.ElementType {
-		case "TMIN":
-			monthly[year][month].sumMin += d.Value
-			monthly[year][month].countMin++
-		case "TMAX":
-			monthly[year][month].sumMax += d.Value
-			monthly[year][month].countMax++
+	monthly := make(map[int]map[time.Month]*monthAggr)
+	for key, m := range aggregateMonths(data) {
+		if _, ok := monthly[key.year]; !ok {
+			monthly[key.year] = make(map[time.Month]*monthAggr)
 		}
+		monthly[key.year][key.month] = m
 	}
 
 	var result []*AnnualStationData
 	for year, months := range monthly {
-		sData := &AnnualStationData{Year: year}
-
-		// compute average of monthly means for TMIN
-		var sumMonthlyMin float64
-		var countMonthlyMin int
-		for _, m := range months {
-			if m.countMin > 0 {
-				sumMonthlyMin += float64(m.sumMin) / float64(m.countMin)
-				countMonthlyMin++
-			}
-		}
-		if countMonthlyMin > 0 {
-			avg := (sumMonthlyMin / float64(countMonthlyMin)) / 10
-			avg = math.Round(avg*10) / 10
-			sData.TMin = &avg
-		}
-
-		// compute average of monthly means for TMAX
-		var sumMonthlyMax float64
-		var countMonthlyMax int
-		for _, m := range months {
-			if m.countMax > 0 {
-				sumMonthlyMax += float64(m.sumMax) / float64(m.countMax)
-				countMonthlyMax++
-			}
-		}
-		if countMonthlyMax > 0 {
-			avg := (sumMonthlyMax / float64(countMonthlyMax)) / 10
-			avg = math.Round(avg*10) / 10
-			sData.TMax = &avg
+		minMonths := rules.MinMonthsPerYear
+		sData := &AnnualStationData{
+			Year:     year,
+			TMin:     summarizeMonths(months, "TMIN", minMonths, rules),
+			TMax:     summarizeMonths(months, "TMAX", minMonths, rules),
+			Prcp:     summarizeMonths(months, "PRCP", minMonths, rules),
+			Snow:     summarizeMonths(months, "SNOW", minMonths, rules),
+			Snwd:     summarizeMonths(months, "SNWD", minMonths, rules),
+			Coverage: periodCoverage(months, time.Date(year, 12, 31, 0, 0, 0, 0, time.UTC).YearDay()),
 		}
-
 		result = append(result, sData)
 	}
 	slices.SortFunc(result, func(a, b *AnnualStationData) int { return a.Year - b.Year })
 	return result
 }
 
-// findStationByID looks up a station's data from the global allStations slice.
+// findStationByID looks up a station's data in the ID index of allStations.
 func findStationByID(id string) *Station {
-	for _, s := range allStations {
-		if s.ID == id {
-			return s
-		}
-	}
-	return nil
+	return stationsByID[id]
 }
 
 // isSouthernHemisphere returns true if the given latitude is below the equator.
@@ -553,68 +1098,81 @@ func isSouthernHemisphere(lat float64) bool {
 	return lat < 0
 }
 
+// seasonOf returns the meteorological season of a month and the year it is
+// attributed to. Jan/Feb belong to the season starting in the previous December.
+func seasonOf(year int, month time.Month, southernHemisphere bool) (int, string) {
+	var season string
+	if southernHemisphere {
+		switch month {
+		case time.March, time.April, time.May:
+			season = "Autumn"
+		case time.June, time.July, time.August:
+			season = "Winter"
+		case time.September, time.October, time.November:
+			season = "Spring"
+		case time.December:
+			season = "Summer"
+		case time.January, time.February:
+			season = "Summer"
+			year-- // Jan/Feb belong to previous year's summer (with Dec)
+		}
+	} else {
+		switch month {
+		case time.March, time.April, time.May:
+			season = "Spring"
+		case time.June, time.July, time.August:
+			season = "Summer"
+		case time.September, time.October, time.November:
+			season = "Autumn"
+		case time.December:
+			season = "Winter"
+		case time.January, time.February:
+			season = "Winter"
+			year-- // Jan/Feb belong to previous year's winter (with Dec)
+		}
+	}
+	return year, season
+}
+
+// seasonDays returns the number of days of a season, including a leap day
+// for winter (summer on the southern hemisphere).
+func seasonDays(year int, season string, southernHemisphere bool) int {
+	days := 0
+	for _, y := range []int{year, year + 1} {
+		for m := time.January; m <= time.December; m++ {
+			if sYear, sName := seasonOf(y, m, southernHemisphere); sYear == year && sName == season {
+				days += daysIn(y, m)
+			}
+		}
+	}
+	return days
+}
+
+// stationInSouthernHemisphere looks up the station's latitude. Unknown stations
+// are treated as northern hemisphere.
+func stationInSouthernHemisphere(id string) bool {
+	if station := findStationByID(id); station != nil && station.Latitude != nil {
+		return isSouthernHemisphere(*station.Latitude)
+	}
+	return false
+}
+
 // defining seasons and calculating seasonal average
 // The seasonal mean is calculated as the average of the monthly means for the
 // months in that season, so that each month contributes equally regardless of
 // how many daily observations it contains (consistent with the annual method).
-func calculateSeasonalAvg(rawData []RawStationData, southernHemisphere bool) []*SeasonalStationData {
-	type MonthAggr struct {
-		sumMin, countMin int
-		sumMax, countMax int
-	}
+// Precipitation and snowfall are summed up over the season.
+func calculateSeasonalAvg(data *stationData, southernHemisphere bool, rules completenessRules) []*SeasonalStationData {
 	// season key (e.g. "2020-Winter") -> month -> daily aggregation
-	monthly := make(map[string]map[time.Month]*MonthAggr)
-
-	for _, d := range rawData {
-		month := d.Date.Month()
-		year := d.Date.Year()
-		var season string
-
-		if southernHemisphere {
-			switch month {
-			case time.March, time.April, time.May:
-				season = "Autumn"
-			case time.June, time.July, time.August:
-				season = "Winter"
-			case time.September, time.October, time.November:
-				season = "Spring"
-			case time.December:
-				season = "Summer"
-			case time.January, time.February:
-				season = "Summer"
-				year-- // Jan/Feb belong to previous year's summer (with Dec)
-			}
-		} else {
-			switch month {
-			case time.March, time.April, time.May:
-				season = "Spring"
-			case time.June, time.July, time.August:
-				season = "Summer"
-			case time.September, time.October, time.November:
-				season = "Autumn"
-			case time.December:
-				season = "Winter"
-			case time.January, time.February:
-				season = "Winter"
-				year-- // Jan/Feb belong to previous year's winter (with Dec)
-			}
-		}
+	monthly := make(map[string]map[time.Month]*monthAggr)
 
+	for mKey, m := range aggregateMonths(data) {
+		year, season := seasonOf(mKey.year, mKey.month, southernHemisphere)
 		key := fmt.Sprintf("%d-%s", year, season)
 		if _, ok := monthly[key]; !ok {
-			monthly[key] = make(map[time.Month]*MonthAggr)
-		}
-		if _, ok := monthly[key][month]; !ok {
-			monthly[key][month] = &MonthAggr{}
-		}
-		switch d.ElementType {
-		case "TMIN":
-			monthly[key][month].sumMin += d.Value
-			monthly[key][month].countMin++
-		case "TMAX":
-			monthly[key][month].sumMax += d.Value
-			monthly[key][month].countMax++
+			monthly[key] = make(map[time.Month]*monthAggr)
 		}
+		monthly[key][mKey.month] = m
 	}
 
 	var result []*SeasonalStationData
@@ -622,38 +1180,17 @@ func calculateSeasonalAvg(rawData []RawStationData, southernHemisphere bool) []*
 		parts := strings.Split(key, "-")
 		year, _ := strconv.Atoi(parts[0])
 		season := parts[1]
-		sData := &SeasonalStationData{Year: year, Season: season}
-
-		// average of monthly means for TMIN
-		var sumMonthlyMin float64
-		var countMonthlyMin int
-		for _, m := range months {
-			if m.countMin > 0 {
-				sumMonthlyMin += float64(m.sumMin) / float64(m.countMin)
-				countMonthlyMin++
-			}
-		}
-		if countMonthlyMin > 0 {
-			avg := (sumMonthlyMin / float64(countMonthlyMin)) / 10.0
-			avg = math.Round(avg*10) / 10
-			sData.TMin = &avg
-		}
-
-		// average of monthly means for TMAX
-		var sumMonthlyMax float64
-		var countMonthlyMax int
-		for _, m := range months {
-			if m.countMax > 0 {
-				sumMonthlyMax += float64(m.sumMax) / float64(m.countMax)
-				countMonthlyMax++
-			}
-		}
-		if countMonthlyMax > 0 {
-			avg := (sumMonthlyMax / float64(countMonthlyMax)) / 10.0
-			avg = math.Round(avg*10) / 10
-			sData.TMax = &avg
+		minMonths := rules.MinMonthsPerSeason
+		sData := &SeasonalStationData{
+			Year:     year,
+			Season:   season,
+			TMin:     summarizeMonths(months, "TMIN", minMonths, rules),
+			TMax:     summarizeMonths(months, "TMAX", minMonths, rules),
+			Prcp:     summarizeMonths(months, "PRCP", minMonths, rules),
+			Snow:     summarizeMonths(months, "SNOW", minMonths, rules),
+			Snwd:     summarizeMonths(months, "SNWD", minMonths, rules),
+			Coverage: periodCoverage(months, seasonDays(year, season, southernHemisphere)),
 		}
-
 		result = append(result, sData)
 	}
 	slices.SortFunc(result, func(a, b *SeasonalStationData) int {
@@ -681,48 +1218,306 @@ func stationHandler(w http.ResponseWriter, r *http.Request) {
 		enc.Encode(response)
 		return
 	}
+	qc, err := parseQCFilter(q)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := Response{Data: nil, ErrorMsg: "Please provide valid quality flag options (includeFlagged=true|false, qflags=D,G,...)."}
+		enc.Encode(response)
+		return
+	}
+
+	rules, err := parseCompleteness(q)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := Response{Data: nil, ErrorMsg: fmt.Sprintf("Please provide valid completeness rules: %v.", err)}
+		enc.Encode(response)
+		return
+	}
+
+	anomaly, refStart, refEnd, err := parseAnomalyParams(q)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := Response{Data: nil, ErrorMsg: "Please provide a valid reference period (refStart/refEnd years)."}
+		enc.Encode(response)
+		return
+	}
+
+	trendStart, trendEnd, err := parseTrendWindow(q)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := Response{Data: nil, ErrorMsg: "Please provide a valid trend window (trendStart/trendEnd years)."}
+		enc.Encode(response)
+		return
+	}
 
 	rawData, err := getStationData(id)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(fetchErrorStatus(err))
 		response := Response{Data: nil, ErrorMsg: err.Error()}
 		enc.Encode(response)
 		return
 	}
+	rawData = applyQCFilter(rawData, qc)
 
-	annualData := calculateAnnualAvg(rawData)
+	annualData := calculateAnnualAvg(rawData, rules)
 
 	// Determine hemisphere from station latitude for correct season mapping
-	southern := false
-	if station := findStationByID(id); station != nil && station.Latitude != nil {
-		southern = isSouthernHemisphere(*station.Latitude)
-	}
-	seasonalData := calculateSeasonalAvg(rawData, southern)
+	southern := stationInSouthernHemisphere(id)
+	seasonalData := calculateSeasonalAvg(rawData, southern, rules)
 
 	detailData := StationDetailResponse{
 		Annual:   annualData,
 		Seasonal: seasonalData,
+		Analysis: calculateTrendAnalysis(annualData, seasonalData, trendStart, trendEnd),
+	}
+
+	errMsg := ""
+	if anomaly {
+		ref := calculateAnomalies(annualData, seasonalData, refStart, refEnd, southern)
+		detailData.Anomaly = ref
+		if len(ref.Annual) == 0 {
+			errMsg = fmt.Sprintf("The station does not have enough data in the reference period (%d–%d) to calculate anomalies.", refStart, refEnd)
+		}
+	}
+
+	response := Response{Data: detailData, ErrorMsg: errMsg}
+	enc.Encode(response)
+}
+
+// filterDaily returns the daily values between from and to (inclusive) for the
+// given elements, sorted by date and element. Zero dates and an empty element
+// list mean no restriction.
+func filterDaily(data *stationData, from time.Time, to time.Time, elements []string) []RawStationData {
+	var result []RawStationData
+	for i, e := range data.series {
+		element := supportedElements[i]
+		if len(elements) > 0 && !slices.Contains(elements, element) {
+			continue
+		}
+		lo, hi := 0, e.len()
+		if !from.IsZero() {
+			lo, _ = slices.BinarySearch(e.days, dayOf(from))
+		}
+		if !to.IsZero() {
+			hi, _ = slices.BinarySearch(e.days, dayOf(to)+1)
+		}
+		for r := range e.flags {
+			start, end := max(int(e.flags[r].start), lo), min(e.runEnd(r), hi)
+			for j := start; j < end; j++ {
+				result = append(result, RawStationData{
+					Date:        dateOf(e.days[j]),
+					ElementType: element,
+					Value:       int(e.values[j]),
+					MFlag:       e.flags[r].m,
+					QFlag:       e.flags[r].q,
+					SFlag:       e.flags[r].s,
+				})
+			}
+		}
+	}
+	slices.SortStableFunc(result, func(a, b RawStationData) int {
+		if c := a.Date.Compare(b.Date); c != 0 {
+			return c
+		}
+		return slices.Index(supportedElements, a.ElementType) - slices.Index(supportedElements, b.ElementType)
+	})
+	return result
+}
+
+func dailyHandler(w http.ResponseWriter, r *http.Request) {
+	//cors handling
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+	q := r.URL.Query()
+	id := q.Get("id")
+	fromStr := q.Get("from")
+	toStr := q.Get("to")
+	limitStr := q.Get("limit")
+	offsetStr := q.Get("offset")
+	enc := json.NewEncoder(w)
+	const layout = "2006-01-02"
+
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		response := Response{Data: nil, ErrorMsg: "Please provide a valid station ID."}
+		enc.Encode(response)
+		return
+	}
+	var from, to time.Time
+	var err error
+	if fromStr != "" {
+		from, err = time.Parse(layout, fromStr)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			response := Response{Data: nil, ErrorMsg: "Please provide a valid from date (YYYY-MM-DD)."}
+			enc.Encode(response)
+			return
+		}
+	}
+	if toStr != "" {
+		to, err = time.Parse(layout, toStr)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			response := Response{Data: nil, ErrorMsg: "Please provide a valid to date (YYYY-MM-DD)."}
+			enc.Encode(response)
+			return
+		}
+	}
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		w.WriteHeader(http.StatusBadRequest)
+		response := Response{Data: nil, ErrorMsg: "The from date must not be after the to date."}
+		enc.Encode(response)
+		return
+	}
+	elements, err := parseElements(q.Get("elements"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := Response{Data: nil, ErrorMsg: "Please provide valid elements (TMIN, TMAX, PRCP, SNOW, SNWD)."}
+		enc.Encode(response)
+		return
+	}
+	limit := defaultDailyLimit
+	if limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > maxDailyLimit {
+			w.WriteHeader(http.StatusBadRequest)
+			response := Response{Data: nil, ErrorMsg: fmt.Sprintf("Please provide a limit between 1 and %d.", maxDailyLimit)}
+			enc.Encode(response)
+			return
+		}
+	}
+	offset := 0
+	if offsetStr != "" {
+		offset, err = strconv.Atoi(offsetStr)
+		if err != nil || offset < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			response := Response{Data: nil, ErrorMsg: "Please provide a valid offset."}
+			enc.Encode(response)
+			return
+		}
+	}
+	qc, err := parseQCFilter(q)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := Response{Data: nil, ErrorMsg: "Please provide valid quality flag options (includeFlagged=true|false, qflags=D,G,...)."}
+		enc.Encode(response)
+		return
 	}
 
-	response := Response{Data: detailData, ErrorMsg: ""}
+	rawData, err := getStationData(id)
+	if err != nil {
+		w.WriteHeader(fetchErrorStatus(err))
+		response := Response{Data: nil, ErrorMsg: err.Error()}
+		enc.Encode(response)
+		return
+	}
+
+	filtered := filterDaily(applyQCFilter(rawData, qc), from, to, elements)
+	page := DailyStationResponse{
+		Total:        len(filtered),
+		Offset:       offset,
+		Limit:        limit,
+		Observations: []*DailyObservation{},
+	}
+	for i := offset; i < len(filtered) && i < offset+limit; i++ {
+		d := filtered[i]
+		page.Observations = append(page.Observations, &DailyObservation{
+			Date:    d.Date.Format(layout),
+			Element: d.ElementType,
+			Value:   *toUnit(float64(d.Value), d.ElementType),
+			MFlag:   flagString(d.MFlag),
+			QFlag:   flagString(d.QFlag),
+			SFlag:   flagString(d.SFlag),
+		})
+	}
+
+	response := Response{Data: page, ErrorMsg: ""}
+	enc.Encode(response)
+}
+
+func monthlyHandler(w http.ResponseWriter, r *http.Request) {
+	//cors handling
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+	q := r.URL.Query()
+	id := q.Get("id")
+	enc := json.NewEncoder(w)
+
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		response := Response{Data: nil, ErrorMsg: "Please provide a valid station ID."}
+		enc.Encode(response)
+		return
+	}
+	qc, err := parseQCFilter(q)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := Response{Data: nil, ErrorMsg: "Please provide valid quality flag options (includeFlagged=true|false, qflags=D,G,...)."}
+		enc.Encode(response)
+		return
+	}
+
+	rawData, err := getStationData(id)
+	if err != nil {
+		w.WriteHeader(fetchErrorStatus(err))
+		response := Response{Data: nil, ErrorMsg: err.Error()}
+		enc.Encode(response)
+		return
+	}
+
+	response := Response{Data: calculateMonthly(applyQCFilter(rawData, qc)), ErrorMsg: ""}
 	enc.Encode(response)
 }
 
 func main() {
-	err := loadInventory()
+	var err error
+	source, err = newDataSource()
+	if err != nil {
+		fmt.Printf("Fehler bei der Datenquelle: %v\n", err)
+		return
+	}
+	cache, err = newStationCacheFromEnv()
+	if err != nil {
+		fmt.Printf("Fehler beim Öffnen des Caches: %v\n", err)
+		return
+	}
+	cache.startSweeper(cacheSweepInterval)
+	disk, err = newDiskCacheFromEnv()
+	if err != nil {
+		fmt.Printf("Fehler beim Öffnen des Caches: %v\n", err)
+		return
+	}
+	coverageQueue.start(coverageFetchWorkers)
+	err = loadInventory()
 	if err != nil {
 		// file for rough filtering
 		fmt.Printf("Fehler beim Laden des Inventars: %v\n", err)
 		return
 	}
+	err = loadCountries()
+	if err != nil {
+		fmt.Printf("Fehler beim Laden der Länder: %v\n", err)
+		return
+	}
 	err = initStations()
 	if err != nil {
 		fmt.Printf("Fehler beim Laden der Stationen: %v\n", err)
 		return
 	}
+	indexStations()
 	http.HandleFunc("/status", statusHandler)
 	fmt.Println("Starting server on :8080")
 	http.HandleFunc("/stations", stationsHandler)
+	http.HandleFunc("/stations/search", searchHandler)
+	http.HandleFunc("/countries", countriesHandler)
 	http.HandleFunc("/station", stationHandler)
+	http.HandleFunc("/station/monthly", monthlyHandler)
+	http.HandleFunc("/station/daily", dailyHandler)
+	http.HandleFunc("/station/normals", normalsHandler)
+	http.HandleFunc("/station/indices", indicesHandler)
+	http.HandleFunc("/station/inventory", inventoryHandler)
+	http.HandleFunc("/cache/stats", cacheStatsHandler)
 	http.ListenAndServe(":8080", nil)
 }
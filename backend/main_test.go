@@ -6,6 +6,11 @@ import (
 	"math"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -23,12 +28,12 @@ func approxEqual(a, b float64, tol float64) bool {
 // ─── calculateAnnualAvg Tests ──────────────────────────────────────────────────
 
 func TestCalculateAnnualAvg_EmptyInput(t *testing.T) {
-	result := calculateAnnualAvg(nil)
+	result := calculateAnnualAvg(&stationData{}, noCompleteness)
 	if len(result) != 0 {
 		t.Errorf("expected empty result for nil input, got %d items", len(result))
 	}
 
-	result = calculateAnnualAvg([]RawStationData{})
+	result = calculateAnnualAvg(newStationData([]RawStationData{}), noCompleteness)
 	if len(result) != 0 {
 		t.Errorf("expected empty result for empty input, got %d items", len(result))
 	}
@@ -42,7 +47,7 @@ func TestCalculateAnnualAvg_SingleYear_TMinAndTMax(t *testing.T) {
 		{Date: time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), ElementType: "TMAX", Value: 400},
 	}
 
-	result := calculateAnnualAvg(raw)
+	result := calculateAnnualAvg(newStationData(raw), noCompleteness)
 	if len(result) != 1 {
 		t.Fatalf("expected 1 year, got %d", len(result))
 	}
@@ -74,7 +79,7 @@ func TestCalculateAnnualAvg_MultipleYears_SortedByYear(t *testing.T) {
 		{Date: time.Date(2021, 9, 20, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: 300},
 	}
 
-	result := calculateAnnualAvg(raw)
+	result := calculateAnnualAvg(newStationData(raw), noCompleteness)
 	if len(result) != 3 {
 		t.Fatalf("expected 3 years, got %d", len(result))
 	}
@@ -91,7 +96,7 @@ func TestCalculateAnnualAvg_OnlyTMin_TMaxIsNil(t *testing.T) {
 		{Date: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: 100},
 	}
 
-	result := calculateAnnualAvg(raw)
+	result := calculateAnnualAvg(newStationData(raw), noCompleteness)
 	if len(result) != 1 {
 		t.Fatalf("expected 1 result, got %d", len(result))
 	}
@@ -108,7 +113,7 @@ func TestCalculateAnnualAvg_OnlyTMax_TMinIsNil(t *testing.T) {
 		{Date: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), ElementType: "TMAX", Value: 250},
 	}
 
-	result := calculateAnnualAvg(raw)
+	result := calculateAnnualAvg(newStationData(raw), noCompleteness)
 	if len(result) != 1 {
 		t.Fatalf("expected 1 result, got %d", len(result))
 	}
@@ -126,7 +131,7 @@ func TestCalculateAnnualAvg_DividesByTen(t *testing.T) {
 		{Date: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: 157},
 	}
 
-	result := calculateAnnualAvg(raw)
+	result := calculateAnnualAvg(newStationData(raw), noCompleteness)
 	// 157 / 10 = 15.7
 	if !approxEqual(*result[0].TMin, 15.7, 0.01) {
 		t.Errorf("expected TMin ~15.7 (value/10), got %f", *result[0].TMin)
@@ -139,7 +144,7 @@ func TestCalculateAnnualAvg_RoundsToOneDecimal(t *testing.T) {
 		{Date: time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: 200},
 		{Date: time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: 103},
 	}
-	result := calculateAnnualAvg(raw)
+	result := calculateAnnualAvg(newStationData(raw), noCompleteness)
 	// avg = (100+200+103)/3 = 134.333... -> /10 = 13.4333... -> rounded = 13.4
 	if !approxEqual(*result[0].TMin, 13.4, 0.001) {
 		t.Errorf("expected TMin ~13.4 (rounded to 1 decimal), got %f", *result[0].TMin)
@@ -151,7 +156,7 @@ func TestCalculateAnnualAvg_NegativeValues(t *testing.T) {
 		{Date: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: -200},
 		{Date: time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: -100},
 	}
-	result := calculateAnnualAvg(raw)
+	result := calculateAnnualAvg(newStationData(raw), noCompleteness)
 	// avg = (-200 + -100)/2 = -150 -> /10 = -15.0
 	if !approxEqual(*result[0].TMin, -15.0, 0.01) {
 		t.Errorf("expected TMin ~-15.0, got %f", *result[0].TMin)
@@ -161,7 +166,7 @@ func TestCalculateAnnualAvg_NegativeValues(t *testing.T) {
 // ─── calculateSeasonalAvg Tests ────────────────────────────────────────────────
 
 func TestCalculateSeasonalAvg_EmptyInput(t *testing.T) {
-	result := calculateSeasonalAvg(nil, false)
+	result := calculateSeasonalAvg(&stationData{}, false, noCompleteness)
 	if len(result) != 0 {
 		t.Errorf("expected empty result for nil input, got %d", len(result))
 	}
@@ -192,7 +197,7 @@ func TestCalculateSeasonalAvg_CorrectSeasonAssignment(t *testing.T) {
 			raw := []RawStationData{
 				{Date: time.Date(2020, tc.month, 15, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: 100},
 			}
-			result := calculateSeasonalAvg(raw, false)
+			result := calculateSeasonalAvg(newStationData(raw), false, noCompleteness)
 			if len(result) != 1 {
 				t.Fatalf("expected 1 result, got %d", len(result))
 			}
@@ -210,7 +215,7 @@ func TestCalculateSeasonalAvg_AggregatesWithinSeason(t *testing.T) {
 		{Date: time.Date(2020, 7, 15, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: 250},
 		{Date: time.Date(2020, 8, 15, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: 300},
 	}
-	result := calculateSeasonalAvg(raw, false)
+	result := calculateSeasonalAvg(newStationData(raw), false, noCompleteness)
 	if len(result) != 1 {
 		t.Fatalf("expected 1 seasonal result, got %d", len(result))
 	}
@@ -231,7 +236,7 @@ func TestCalculateSeasonalAvg_SortOrder(t *testing.T) {
 		{Date: time.Date(2020, 10, 15, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: 100}, // Autumn
 		{Date: time.Date(2020, 4, 15, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: 100},  // Spring
 	}
-	result := calculateSeasonalAvg(raw, false)
+	result := calculateSeasonalAvg(newStationData(raw), false, noCompleteness)
 	if len(result) != 4 {
 		t.Fatalf("expected 4 results, got %d", len(result))
 	}
@@ -249,7 +254,7 @@ func TestCalculateSeasonalAvg_MultipleYears_SortedByYearThenSeason(t *testing.T)
 		{Date: time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: 100}, // Winter 2019 (Jan shifts year--)
 		{Date: time.Date(2020, 7, 15, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: 100}, // Summer 2020
 	}
-	result := calculateSeasonalAvg(raw, false)
+	result := calculateSeasonalAvg(newStationData(raw), false, noCompleteness)
 	if len(result) != 3 {
 		t.Fatalf("expected 3 results, got %d", len(result))
 	}
@@ -270,7 +275,7 @@ func TestCalculateSeasonalAvg_TMinAndTMaxBothPresent(t *testing.T) {
 		{Date: time.Date(2020, 7, 1, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: 200},
 		{Date: time.Date(2020, 7, 1, 0, 0, 0, 0, time.UTC), ElementType: "TMAX", Value: 350},
 	}
-	result := calculateSeasonalAvg(raw, false)
+	result := calculateSeasonalAvg(newStationData(raw), false, noCompleteness)
 	if len(result) != 1 {
 		t.Fatalf("expected 1, got %d", len(result))
 	}
@@ -289,7 +294,7 @@ func TestCalculateSeasonalAvg_NilPointersWhenMissing(t *testing.T) {
 	raw := []RawStationData{
 		{Date: time.Date(2020, 7, 1, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: 200},
 	}
-	result := calculateSeasonalAvg(raw, false)
+	result := calculateSeasonalAvg(newStationData(raw), false, noCompleteness)
 	if result[0].TMin == nil {
 		t.Error("expected TMin non-nil")
 	}
@@ -300,22 +305,32 @@ func TestCalculateSeasonalAvg_NilPointersWhenMissing(t *testing.T) {
 
 // ─── findStations Tests ────────────────────────────────────────────────────────
 
-// setupGlobalState sets up the global allStations and inventoryMap for testing.
+// temperatureInventory returns an inventory with TMIN and TMAX from first to last year.
+func temperatureInventory(first int, last int) *StationInventory {
+	return &StationInventory{Elements: map[string]*ElementInventory{
+		"TMIN": {FirstYear: first, LastYear: last},
+		"TMAX": {FirstYear: first, LastYear: last},
+	}}
+}
+
+// setupGlobalState sets up the global allStations, its spatial index and inventoryMap for testing.
 // Must be called before findStations tests. Cleans up after test completes.
 func setupGlobalState(t *testing.T, stations []*Station, inventory map[string]*StationInventory) {
 	oldStations := allStations
 	oldInventory := inventoryMap
 	allStations = stations
 	inventoryMap = inventory
+	indexStations()
 	t.Cleanup(func() {
 		allStations = oldStations
 		inventoryMap = oldInventory
+		indexStations()
 	})
 }
 
 func TestFindStations_EmptyStations(t *testing.T) {
 	setupGlobalState(t, []*Station{}, map[string]*StationInventory{})
-	result, err := findStations(52.5, 13.4, 100, 10, 1900, 2020)
+	result, err := findStations(52.5, 13.4, 100, 10, stationFilter{StartYear: 1900, EndYear: 2020})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -334,13 +349,13 @@ func TestFindStations_FiltersOutOfRadius(t *testing.T) {
 			{ID: "STN002", Name: "Paris", Latitude: &lat2, Longitude: &long2},
 		},
 		map[string]*StationInventory{
-			"STN001": {FirstYear: 1900, LastYear: 2023},
-			"STN002": {FirstYear: 1900, LastYear: 2023},
+			"STN001": temperatureInventory(1900, 2023),
+			"STN002": temperatureInventory(1900, 2023),
 		},
 	)
 
 	// Radius 100 km from Berlin - should only find Berlin
-	result, err := findStations(52.52, 13.405, 100, 10, 1950, 2020)
+	result, err := findStations(52.52, 13.405, 100, 10, stationFilter{StartYear: 1950, EndYear: 2020})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -352,7 +367,7 @@ func TestFindStations_FiltersOutOfRadius(t *testing.T) {
 	}
 
 	// Radius 1000 km - should find both
-	result, err = findStations(52.52, 13.405, 1000, 10, 1950, 2020)
+	result, err = findStations(52.52, 13.405, 1000, 10, stationFilter{StartYear: 1950, EndYear: 2020})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -371,13 +386,13 @@ func TestFindStations_FiltersbyInventoryYears(t *testing.T) {
 			{ID: "STN003", Name: "Partial", Latitude: &lat, Longitude: &long},
 		},
 		map[string]*StationInventory{
-			"STN001": {FirstYear: 1900, LastYear: 2023},
-			"STN002": {FirstYear: 2000, LastYear: 2010}, // firstYear > startYear requested
+			"STN001": temperatureInventory(1900, 2023),
+			"STN002": temperatureInventory(2000, 2010), // firstYear > startYear requested
 			// STN003 has no inventory entry at all
 		},
 	)
 
-	result, err := findStations(52.52, 13.405, 100, 10, 1950, 2020)
+	result, err := findStations(52.52, 13.405, 100, 10, stationFilter{StartYear: 1950, EndYear: 2020})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -401,13 +416,13 @@ func TestFindStations_SortsByDistance(t *testing.T) {
 			{ID: "BERLIN", Name: "Berlin Ctr", Latitude: &latBerlin, Longitude: &longBerlin},
 		},
 		map[string]*StationInventory{
-			"DRESDEN": {FirstYear: 1900, LastYear: 2023},
-			"POTSDAM": {FirstYear: 1900, LastYear: 2023},
-			"BERLIN":  {FirstYear: 1900, LastYear: 2023},
+			"DRESDEN": temperatureInventory(1900, 2023),
+			"POTSDAM": temperatureInventory(1900, 2023),
+			"BERLIN":  temperatureInventory(1900, 2023),
 		},
 	)
 
-	result, err := findStations(52.52, 13.405, 500, 10, 1950, 2020)
+	result, err := findStations(52.52, 13.405, 500, 10, stationFilter{StartYear: 1950, EndYear: 2020})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -441,12 +456,12 @@ func TestFindStations_LimitResults(t *testing.T) {
 		sLat := lat + float64(i)*0.01
 		sLong := long
 		stations[i] = &Station{ID: id, Name: id, Latitude: &sLat, Longitude: &sLong}
-		inv[id] = &StationInventory{FirstYear: 1900, LastYear: 2023}
+		inv[id] = temperatureInventory(1900, 2023)
 	}
 
 	setupGlobalState(t, stations, inv)
 
-	result, err := findStations(52.52, 13.405, 5000, 5, 1950, 2020)
+	result, err := findStations(52.52, 13.405, 5000, 5, stationFilter{StartYear: 1950, EndYear: 2020})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -463,12 +478,12 @@ func TestFindStations_SkipsNilLatLong(t *testing.T) {
 			{ID: "STN002", Name: "No Long", Latitude: &lat, Longitude: nil},
 		},
 		map[string]*StationInventory{
-			"STN001": {FirstYear: 1900, LastYear: 2023},
-			"STN002": {FirstYear: 1900, LastYear: 2023},
+			"STN001": temperatureInventory(1900, 2023),
+			"STN002": temperatureInventory(1900, 2023),
 		},
 	)
 
-	result, err := findStations(52.52, 13.405, 5000, 10, 1950, 2020)
+	result, err := findStations(52.52, 13.405, 5000, 10, stationFilter{StartYear: 1950, EndYear: 2020})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -487,11 +502,11 @@ func TestFindStations_HaversineDistance_Accuracy(t *testing.T) {
 			{ID: "MUNICH", Name: "Munich", Latitude: &latMunich, Longitude: &longMunich},
 		},
 		map[string]*StationInventory{
-			"MUNICH": {FirstYear: 1900, LastYear: 2023},
+			"MUNICH": temperatureInventory(1900, 2023),
 		},
 	)
 
-	result, err := findStations(latBerlin, longBerlin, 600, 10, 1950, 2020)
+	result, err := findStations(latBerlin, longBerlin, 600, 10, stationFilter{StartYear: 1950, EndYear: 2020})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -512,11 +527,11 @@ func TestFindStations_LimitGreaterThanResults(t *testing.T) {
 			{ID: "STN001", Name: "Only One", Latitude: &lat, Longitude: &long},
 		},
 		map[string]*StationInventory{
-			"STN001": {FirstYear: 1900, LastYear: 2023},
+			"STN001": temperatureInventory(1900, 2023),
 		},
 	)
 
-	result, err := findStations(52.52, 13.405, 100, 100, 1950, 2020)
+	result, err := findStations(52.52, 13.405, 100, 100, stationFilter{StartYear: 1950, EndYear: 2020})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -612,7 +627,7 @@ func TestStationsHandler_ValidRequest(t *testing.T) {
 			{ID: "STN001", Name: "Berlin", Latitude: &lat, Longitude: &long},
 		},
 		map[string]*StationInventory{
-			"STN001": {FirstYear: 1900, LastYear: 2023},
+			"STN001": temperatureInventory(1900, 2023),
 		},
 	)
 
@@ -642,7 +657,7 @@ func TestStationsHandler_SetsCORSHeaders(t *testing.T) {
 			{ID: "STN001", Name: "Berlin", Latitude: &lat, Longitude: &long},
 		},
 		map[string]*StationInventory{
-			"STN001": {FirstYear: 1900, LastYear: 2023},
+			"STN001": temperatureInventory(1900, 2023),
 		},
 	)
 
@@ -695,8 +710,8 @@ func TestStationHandler_SetsCORSHeaders(t *testing.T) {
 // The handler maps station IDs to CSV content.
 func newMockS3Server(csvByStation map[string]string) *httptest.Server {
 	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// URL pattern: /{stationID}.csv
-		path := r.URL.Path
+		// URL pattern: /csv/by_station/{stationID}.csv
+		path := strings.TrimPrefix(r.URL.Path, "/csv/by_station")
 		// Extract station ID from path like /USW00094728.csv
 		if len(path) > 5 && path[len(path)-4:] == ".csv" {
 			id := path[1 : len(path)-4]
@@ -713,21 +728,40 @@ func newMockS3Server(csvByStation map[string]string) *httptest.Server {
 // setupCache resets the global cache for testing. Cleans up after test completes.
 func setupCache(t *testing.T) {
 	oldCache := cache
-	cache = &stationCache{entries: make(map[string]cacheEntry)}
+	cache = newStationCache(defaultCacheMaxEntries, defaultCacheMaxBytes)
 	t.Cleanup(func() {
 		cache = oldCache
 	})
 }
 
-// setupBaseURL overrides the global baseURL for testing. Cleans up after test completes.
-func setupBaseURL(t *testing.T, url string) {
-	oldURL := baseURL
-	baseURL = url
+// setupSource overrides the global data source for testing. Cleans up after test completes.
+func setupSource(t *testing.T, src dataSource) {
+	oldSource := source
+	source = src
 	t.Cleanup(func() {
-		baseURL = oldURL
+		source = oldSource
 	})
 }
 
+// newStationData converts rows into columns, rows of unsupported elements
+// or with values that do not fit into int16 are dropped
+func newStationData(rows []RawStationData) *stationData {
+	var b stationDataBuilder
+	for _, r := range rows {
+		element := slices.Index(supportedElements, r.ElementType)
+		if element < 0 || r.Value < math.MinInt16 || r.Value > math.MaxInt16 {
+			continue
+		}
+		b.add(element, dayOf(r.Date), int16(r.Value), r.MFlag, r.QFlag, r.SFlag)
+	}
+	return b.data()
+}
+
+// allRows returns all observations sorted by date and element
+func allRows(data *stationData) []RawStationData {
+	return filterDaily(data, time.Time{}, time.Time{}, nil)
+}
+
 // ─── loadStationData Tests (with mock HTTP server) ─────────────────────────────
 
 func TestLoadStationData_ParsesCSVCorrectly(t *testing.T) {
@@ -740,14 +774,15 @@ func TestLoadStationData_ParsesCSVCorrectly(t *testing.T) {
 	server := newMockS3Server(map[string]string{"USW00094728": csvData})
 	defer server.Close()
 
-	result, err := loadStationData(server.URL, "USW00094728")
+	data, _, err := loadStationData(&httpSource{baseURL: server.URL}, "USW00094728", stationVersion{})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
+	result := allRows(data)
 
-	// Should have 3 entries (2 TMIN + 1 TMAX), PRCP filtered out
-	if len(result) != 3 {
-		t.Fatalf("expected 3 records (TMIN+TMAX only), got %d", len(result))
+	// Should have 4 entries (2 TMIN + 1 TMAX + 1 PRCP)
+	if len(result) != 4 {
+		t.Fatalf("expected 4 records (TMIN+TMAX+PRCP), got %d", len(result))
 	}
 
 	// Verify first record
@@ -759,27 +794,30 @@ func TestLoadStationData_ParsesCSVCorrectly(t *testing.T) {
 	}
 }
 
-func TestLoadStationData_FiltersTMINandTMAXOnly(t *testing.T) {
+func TestLoadStationData_FiltersSupportedElementsOnly(t *testing.T) {
 	csvData := `"ID","DATE","ELEMENT","DATA_VALUE","M_FLAG","Q_FLAG","S_FLAG","OBS_TIME"
 "STN001","20200101","TMIN",50,"","","S",""
 "STN001","20200101","TMAX",120,"","","S",""
 "STN001","20200101","PRCP",5,"","","S",""
 "STN001","20200101","SNOW",0,"","","S",""
 "STN001","20200101","SNWD",0,"","","S",""
+"STN001","20200101","AWND",31,"","","S",""
+"STN001","20200101","WT01",1,"","","S",""
 `
 	server := newMockS3Server(map[string]string{"STN001": csvData})
 	defer server.Close()
 
-	result, err := loadStationData(server.URL, "STN001")
+	data, _, err := loadStationData(&httpSource{baseURL: server.URL}, "STN001", stationVersion{})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
+	result := allRows(data)
 
-	if len(result) != 2 {
-		t.Errorf("expected 2 records (TMIN+TMAX), got %d", len(result))
+	if len(result) != 5 {
+		t.Errorf("expected 5 records (TMIN+TMAX+PRCP+SNOW+SNWD), got %d", len(result))
 	}
 	for _, r := range result {
-		if r.ElementType != "TMIN" && r.ElementType != "TMAX" {
+		if !isSupportedElement(r.ElementType) {
 			t.Errorf("unexpected element type: %s", r.ElementType)
 		}
 	}
@@ -795,10 +833,11 @@ func TestLoadStationData_Minus9999IsSkipped(t *testing.T) {
 	server := newMockS3Server(map[string]string{"STN001": csvData})
 	defer server.Close()
 
-	result, err := loadStationData(server.URL, "STN001")
+	data, _, err := loadStationData(&httpSource{baseURL: server.URL}, "STN001", stationVersion{})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
+	result := allRows(data)
 
 	// Only 2 valid records (the two -9999 values should be filtered)
 	if len(result) != 2 {
@@ -822,10 +861,11 @@ func TestLoadStationData_MalformedLines(t *testing.T) {
 	server := newMockS3Server(map[string]string{"STN001": csvData})
 	defer server.Close()
 
-	result, err := loadStationData(server.URL, "STN001")
+	data, _, err := loadStationData(&httpSource{baseURL: server.URL}, "STN001", stationVersion{})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
+	result := allRows(data)
 
 	// baddate and notanumber lines should be skipped gracefully
 	if len(result) != 2 {
@@ -842,10 +882,11 @@ func TestLoadStationData_ShortLines(t *testing.T) {
 	server := newMockS3Server(map[string]string{"STN001": csvData})
 	defer server.Close()
 
-	result, err := loadStationData(server.URL, "STN001")
+	data, _, err := loadStationData(&httpSource{baseURL: server.URL}, "STN001", stationVersion{})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
+	result := allRows(data)
 
 	// Short line should be skipped (len < 4 columns)
 	if len(result) != 2 {
@@ -857,7 +898,7 @@ func TestLoadStationData_HTTP404(t *testing.T) {
 	server := newMockS3Server(map[string]string{}) // no stations registered
 	defer server.Close()
 
-	_, err := loadStationData(server.URL, "NONEXISTENT")
+	_, _, err := loadStationData(&httpSource{baseURL: server.URL}, "NONEXISTENT", stationVersion{})
 	if err == nil {
 		t.Fatal("expected error for 404, got nil")
 	}
@@ -865,7 +906,7 @@ func TestLoadStationData_HTTP404(t *testing.T) {
 
 func TestLoadStationData_NetworkError(t *testing.T) {
 	// Use an invalid URL that will fail to connect
-	_, err := loadStationData("http://127.0.0.1:1", "STN001")
+	_, _, err := loadStationData(&httpSource{baseURL: "http://127.0.0.1:1"}, "STN001", stationVersion{})
 	if err == nil {
 		t.Fatal("expected network error, got nil")
 	}
@@ -877,10 +918,11 @@ func TestLoadStationData_EmptyCSV(t *testing.T) {
 	server := newMockS3Server(map[string]string{"STN001": csvData})
 	defer server.Close()
 
-	result, err := loadStationData(server.URL, "STN001")
+	data, _, err := loadStationData(&httpSource{baseURL: server.URL}, "STN001", stationVersion{})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
+	result := allRows(data)
 	if len(result) != 0 {
 		t.Errorf("expected 0 records for empty CSV body, got %d", len(result))
 	}
@@ -895,10 +937,11 @@ func TestLoadStationData_SkipsHeaderRow(t *testing.T) {
 	server := newMockS3Server(map[string]string{"STN001": csvData})
 	defer server.Close()
 
-	result, err := loadStationData(server.URL, "STN001")
+	data, _, err := loadStationData(&httpSource{baseURL: server.URL}, "STN001", stationVersion{})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
+	result := allRows(data)
 	if len(result) != 1 {
 		t.Errorf("expected 1 record, got %d", len(result))
 	}
@@ -916,16 +959,17 @@ func TestLoadStationData_MultipleYearsOfData(t *testing.T) {
 	server := newMockS3Server(map[string]string{"STN001": csvData})
 	defer server.Close()
 
-	result, err := loadStationData(server.URL, "STN001")
+	data, _, err := loadStationData(&httpSource{baseURL: server.URL}, "STN001", stationVersion{})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
+	result := allRows(data)
 	if len(result) != 6 {
 		t.Errorf("expected 6 records, got %d", len(result))
 	}
 
 	// Verify the data feeds correctly into annual calculation
-	annual := calculateAnnualAvg(result)
+	annual := calculateAnnualAvg(data, noCompleteness)
 	if len(annual) != 3 {
 		t.Errorf("expected 3 years from loaded data, got %d", len(annual))
 	}
@@ -947,24 +991,22 @@ func TestGetStationData_CacheMiss_FetchesAndCaches(t *testing.T) {
 		w.Write([]byte(csvData))
 	}))
 	defer server.Close()
-	setupBaseURL(t, server.URL)
+	setupSource(t, &httpSource{baseURL: server.URL})
 
 	// First call - cache miss, should fetch from server
 	data, err := getStationData("STN001")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if len(data) != 2 {
-		t.Errorf("expected 2 records, got %d", len(data))
+	if data.len() != 2 {
+		t.Errorf("expected 2 records, got %d", data.len())
 	}
 	if atomic.LoadInt32(&fetchCount) != 1 {
 		t.Errorf("expected 1 fetch on cache miss, got %d", fetchCount)
 	}
 
 	// Verify entry is now in cache
-	cache.mu.RLock()
-	_, exists := cache.entries["STN001"]
-	cache.mu.RUnlock()
+	_, exists := cache.get("STN001")
 	if !exists {
 		t.Error("expected cache entry after first fetch")
 	}
@@ -983,7 +1025,7 @@ func TestGetStationData_CacheHit_NoSecondFetch(t *testing.T) {
 		w.Write([]byte(csvData))
 	}))
 	defer server.Close()
-	setupBaseURL(t, server.URL)
+	setupSource(t, &httpSource{baseURL: server.URL})
 
 	// First call - fetches from server
 	_, err := getStationData("STN001")
@@ -996,8 +1038,8 @@ func TestGetStationData_CacheHit_NoSecondFetch(t *testing.T) {
 	if err != nil {
 		t.Fatalf("unexpected error on second call: %v", err)
 	}
-	if len(data) != 1 {
-		t.Errorf("expected 1 record from cache, got %d", len(data))
+	if data.len() != 1 {
+		t.Errorf("expected 1 record from cache, got %d", data.len())
 	}
 	if atomic.LoadInt32(&fetchCount) != 1 {
 		t.Errorf("expected only 1 fetch (cache hit on second call), got %d", fetchCount)
@@ -1017,7 +1059,7 @@ func TestGetStationData_CacheExpired_Refetches(t *testing.T) {
 		w.Write([]byte(csvData))
 	}))
 	defer server.Close()
-	setupBaseURL(t, server.URL)
+	setupSource(t, &httpSource{baseURL: server.URL})
 
 	// First fetch
 	_, err := getStationData("STN001")
@@ -1026,10 +1068,8 @@ func TestGetStationData_CacheExpired_Refetches(t *testing.T) {
 	}
 
 	// Manually expire the cache entry
-	cache.mu.Lock()
-	entry := cache.entries["STN001"]
-	cache.entries["STN001"] = cacheEntry{data: entry.data, fetchedAt: time.Now().Add(-2 * cacheTTL)}
-	cache.mu.Unlock()
+	data, _ := cache.get("STN001")
+	cache.put("STN001", data, stationVersion{}, time.Now().Add(-2*cacheTTL-cacheStaleTTL))
 
 	// Second fetch should re-fetch from server because cache is expired
 	_, err = getStationData("STN001")
@@ -1041,9 +1081,82 @@ func TestGetStationData_CacheExpired_Refetches(t *testing.T) {
 	}
 }
 
+// waitFor polls cond until it is true or a second has passed
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the background revalidation")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestGetStationData_StaleRevalidatedInBackground(t *testing.T) {
+	setupCache(t)
+
+	var mu sync.Mutex
+	etag := `"v1"`
+	csvData := `"ID","DATE","ELEMENT","DATA_VALUE","M_FLAG","Q_FLAG","S_FLAG","OBS_TIME"
+"STN001","20200101","TMIN",100,"","","S",""
+`
+	var downloads, notModified int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			atomic.AddInt32(&notModified, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		atomic.AddInt32(&downloads, 1)
+		w.Write([]byte(csvData))
+	}))
+	defer server.Close()
+	setupSource(t, &httpSource{baseURL: server.URL})
+
+	if _, err := getStationData("STN001"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// an unchanged file only extends the lifetime of the entry
+	data, _ := cache.get("STN001")
+	cache.put("STN001", data, stationVersion{ETag: `"v1"`}, time.Now().Add(-2*cacheTTL))
+	if data, err := getStationData("STN001"); err != nil || data.len() != 1 {
+		t.Fatalf("expected the stale data, got %v %v", data, err)
+	}
+	waitFor(t, func() bool { return cache.stats().NotModified == 1 })
+	if _, _, ok := cache.claimRevalidation("STN001"); ok {
+		t.Error("expected the entry to be fresh after a 304")
+	}
+	if atomic.LoadInt32(&downloads) != 1 || atomic.LoadInt32(&notModified) != 1 {
+		t.Errorf("expected 1 download and 1 revalidation, got %d and %d", downloads, notModified)
+	}
+
+	// a changed file replaces the data, the stale data is served meanwhile
+	mu.Lock()
+	etag = `"v2"`
+	csvData += `"STN001","20200102","TMIN",110,"","","S",""
+`
+	mu.Unlock()
+	cache.put("STN001", data, stationVersion{ETag: `"v1"`}, time.Now().Add(-2*cacheTTL))
+	if data, err := getStationData("STN001"); err != nil || data.len() != 1 {
+		t.Fatalf("expected the stale data, got %v %v", data, err)
+	}
+	waitFor(t, func() bool {
+		data, _ := cache.peek("STN001")
+		return data.len() == 2
+	})
+	if atomic.LoadInt32(&downloads) != 2 {
+		t.Errorf("expected 2 downloads, got %d", downloads)
+	}
+}
+
 func TestGetStationData_FetchError_ReturnsError(t *testing.T) {
 	setupCache(t)
-	setupBaseURL(t, "http://127.0.0.1:1") // invalid, will fail to connect
+	setupSource(t, &httpSource{baseURL: "http://127.0.0.1:1"}) // invalid, will fail to connect
 
 	_, err := getStationData("STN001")
 	if err == nil {
@@ -1062,7 +1175,7 @@ func TestCache_ConcurrentAccess(t *testing.T) {
 		w.Write([]byte(csvData))
 	}))
 	defer server.Close()
-	setupBaseURL(t, server.URL)
+	setupSource(t, &httpSource{baseURL: server.URL})
 
 	// Spawn multiple goroutines calling getStationData concurrently
 	var wg sync.WaitGroup
@@ -1090,9 +1203,7 @@ func TestStationHandler_ValidID_ReturnsAnnualAndSeasonal(t *testing.T) {
 		{Date: time.Date(2020, 7, 15, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: 180},
 		{Date: time.Date(2020, 7, 15, 0, 0, 0, 0, time.UTC), ElementType: "TMAX", Value: 300},
 	}
-	cache.mu.Lock()
-	cache.entries["TESTSTATION"] = cacheEntry{data: rawData, fetchedAt: time.Now()}
-	cache.mu.Unlock()
+	cache.put("TESTSTATION", newStationData(rawData), stationVersion{}, time.Now())
 
 	req := httptest.NewRequest(http.MethodGet, "/station?id=TESTSTATION", nil)
 	rec := httptest.NewRecorder()
@@ -1138,7 +1249,7 @@ func TestStationHandler_FetchesViaCache(t *testing.T) {
 		w.Write([]byte(csvData))
 	}))
 	defer server.Close()
-	setupBaseURL(t, server.URL)
+	setupSource(t, &httpSource{baseURL: server.URL})
 
 	// First request - should fetch from mock server
 	req := httptest.NewRequest(http.MethodGet, "/station?id=LIVE001", nil)
@@ -1167,7 +1278,7 @@ func TestStationHandler_FetchesViaCache(t *testing.T) {
 
 func TestStationHandler_FetchError_Returns500(t *testing.T) {
 	setupCache(t)
-	setupBaseURL(t, "http://127.0.0.1:1") // will fail
+	setupSource(t, &httpSource{baseURL: "http://127.0.0.1:1"}) // will fail
 
 	req := httptest.NewRequest(http.MethodGet, "/station?id=FAILSTN", nil)
 	rec := httptest.NewRecorder()
@@ -1276,7 +1387,7 @@ func TestCalculateAnnualAvg_LargeDataset(t *testing.T) {
 		}
 	}
 
-	result := calculateAnnualAvg(raw)
+	result := calculateAnnualAvg(newStationData(raw), noCompleteness)
 	if len(result) != 20 {
 		t.Errorf("expected 20 years, got %d", len(result))
 	}
@@ -1298,12 +1409,12 @@ func TestFindStations_ZeroRadius(t *testing.T) {
 			{ID: "STN001", Name: "Same Spot", Latitude: &lat, Longitude: &long},
 		},
 		map[string]*StationInventory{
-			"STN001": {FirstYear: 1900, LastYear: 2023},
+			"STN001": temperatureInventory(1900, 2023),
 		},
 	)
 
 	// Radius 0 - the station at the exact coordinates should match (distance ~0)
-	result, err := findStations(52.52, 13.405, 0, 10, 1950, 2020)
+	result, err := findStations(52.52, 13.405, 0, 10, stationFilter{StartYear: 1950, EndYear: 2020})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -1320,18 +1431,18 @@ func TestFindStations_InventoryEndYearFilter(t *testing.T) {
 			{ID: "STN001", Name: "Old Station", Latitude: &lat, Longitude: &long},
 		},
 		map[string]*StationInventory{
-			"STN001": {FirstYear: 1900, LastYear: 1950},
+			"STN001": temperatureInventory(1900, 1950),
 		},
 	)
 
 	// Request endYear=2020 but station data ends at 1950
-	result, _ := findStations(52.52, 13.405, 100, 10, 1900, 2020)
+	result, _ := findStations(52.52, 13.405, 100, 10, stationFilter{StartYear: 1900, EndYear: 2020})
 	if len(result) != 0 {
 		t.Errorf("expected 0 stations (inventory ends before endYear), got %d", len(result))
 	}
 
 	// Request endYear=1950 - should now match
-	result, _ = findStations(52.52, 13.405, 100, 10, 1900, 1950)
+	result, _ = findStations(52.52, 13.405, 100, 10, stationFilter{StartYear: 1900, EndYear: 1950})
 	if len(result) != 1 {
 		t.Errorf("expected 1 station, got %d", len(result))
 	}
@@ -1341,7 +1452,7 @@ func TestCalculateSeasonalAvg_DecemberIsWinter(t *testing.T) {
 	raw := []RawStationData{
 		{Date: time.Date(2020, 12, 15, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: -50},
 	}
-	result := calculateSeasonalAvg(raw, false)
+	result := calculateSeasonalAvg(newStationData(raw), false, noCompleteness)
 	if len(result) != 1 {
 		t.Fatalf("expected 1 result, got %d", len(result))
 	}
@@ -1380,7 +1491,7 @@ func TestCalculateSeasonalAvg_SouthernHemisphere_CorrectSeasonAssignment(t *test
 			raw := []RawStationData{
 				{Date: time.Date(2020, tc.month, 15, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: 100},
 			}
-			result := calculateSeasonalAvg(raw, true)
+			result := calculateSeasonalAvg(newStationData(raw), true, noCompleteness)
 			if len(result) != 1 {
 				t.Fatalf("expected 1 result, got %d", len(result))
 			}
@@ -1395,7 +1506,7 @@ func TestCalculateSeasonalAvg_SouthernHemisphere_DecemberIsSummer(t *testing.T)
 	raw := []RawStationData{
 		{Date: time.Date(2020, 12, 15, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: 250},
 	}
-	result := calculateSeasonalAvg(raw, true)
+	result := calculateSeasonalAvg(newStationData(raw), true, noCompleteness)
 	if len(result) != 1 {
 		t.Fatalf("expected 1 result, got %d", len(result))
 	}
@@ -1414,7 +1525,7 @@ func TestCalculateSeasonalAvg_SouthernHemisphere_JulyIsWinter(t *testing.T) {
 		{Date: time.Date(2020, 7, 15, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: 80},
 		{Date: time.Date(2020, 8, 15, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: 60},
 	}
-	result := calculateSeasonalAvg(raw, true)
+	result := calculateSeasonalAvg(newStationData(raw), true, noCompleteness)
 	if len(result) != 1 {
 		t.Fatalf("expected 1 result, got %d", len(result))
 	}
@@ -1434,7 +1545,7 @@ func TestCalculateSeasonalAvg_SouthernHemisphere_SortOrder(t *testing.T) {
 		{Date: time.Date(2020, 12, 15, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: 100}, // Summer 2020 (SH, Dec stays)
 		{Date: time.Date(2020, 4, 15, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: 100},  // Autumn 2020 (SH)
 	}
-	result := calculateSeasonalAvg(raw, true)
+	result := calculateSeasonalAvg(newStationData(raw), true, noCompleteness)
 	if len(result) != 4 {
 		t.Fatalf("expected 4 results, got %d", len(result))
 	}
@@ -1484,7 +1595,7 @@ func TestCalculateAnnualAvg_MonthlyMeansMethod(t *testing.T) {
 		Date: time.Date(2020, 7, 1, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: 200,
 	})
 
-	result := calculateAnnualAvg(raw)
+	result := calculateAnnualAvg(newStationData(raw), noCompleteness)
 	if len(result) != 1 {
 		t.Fatalf("expected 1 year, got %d", len(result))
 	}
@@ -1512,7 +1623,7 @@ func TestCalculateAnnualAvg_MonthlyMeansMethod_UnequalWeight(t *testing.T) {
 		Date: time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC), ElementType: "TMAX", Value: 310,
 	})
 
-	result := calculateAnnualAvg(raw)
+	result := calculateAnnualAvg(newStationData(raw), noCompleteness)
 	if len(result) != 1 {
 		t.Fatalf("expected 1 year, got %d", len(result))
 	}
@@ -1535,7 +1646,7 @@ func TestCalculateAnnualAvg_AllTwelveMonths(t *testing.T) {
 		})
 	}
 
-	result := calculateAnnualAvg(raw)
+	result := calculateAnnualAvg(newStationData(raw), noCompleteness)
 	if len(result) != 1 {
 		t.Fatalf("expected 1 year, got %d", len(result))
 	}
@@ -1554,7 +1665,7 @@ func TestCalculateSeasonalAvg_DecemberBelongsToNextYearsWinter(t *testing.T) {
 		{Date: time.Date(2021, 1, 15, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: -50},
 		{Date: time.Date(2021, 2, 15, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: 0},
 	}
-	result := calculateSeasonalAvg(raw, false)
+	result := calculateSeasonalAvg(newStationData(raw), false, noCompleteness)
 	if len(result) != 1 {
 		t.Fatalf("expected 1 result (all in Winter 2020), got %d", len(result))
 	}
@@ -1577,7 +1688,7 @@ func TestCalculateSeasonalAvg_JanFebWithoutDecStillCountsAsWinter(t *testing.T)
 		{Date: time.Date(1955, 1, 15, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: -200},
 		{Date: time.Date(1955, 2, 15, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: -100},
 	}
-	result := calculateSeasonalAvg(raw, false)
+	result := calculateSeasonalAvg(newStationData(raw), false, noCompleteness)
 	if len(result) != 1 {
 		t.Fatalf("expected 1 result, got %d", len(result))
 	}
@@ -1601,7 +1712,7 @@ func TestCalculateSeasonalAvg_SouthernHemisphere_DecemberBelongsToNextYearsSumme
 		{Date: time.Date(2021, 1, 15, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: 350},
 		{Date: time.Date(2021, 2, 15, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: 280},
 	}
-	result := calculateSeasonalAvg(raw, true)
+	result := calculateSeasonalAvg(newStationData(raw), true, noCompleteness)
 	if len(result) != 1 {
 		t.Fatalf("expected 1 result (all in Summer 2020), got %d", len(result))
 	}
@@ -1624,7 +1735,7 @@ func TestCalculateSeasonalAvg_SouthernHemisphere_JanFebWithoutDecStillCountsAsSu
 		{Date: time.Date(1955, 1, 15, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: 250},
 		{Date: time.Date(1955, 2, 15, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: 300},
 	}
-	result := calculateSeasonalAvg(raw, true)
+	result := calculateSeasonalAvg(newStationData(raw), true, noCompleteness)
 	if len(result) != 1 {
 		t.Fatalf("expected 1 result, got %d", len(result))
 	}
@@ -1647,7 +1758,7 @@ func TestCalculateSeasonalAvg_ConsecutiveWinters(t *testing.T) {
 		{Date: time.Date(2021, 1, 15, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: -90},
 		{Date: time.Date(2021, 2, 15, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: -70},
 	}
-	result := calculateSeasonalAvg(raw, false)
+	result := calculateSeasonalAvg(newStationData(raw), false, noCompleteness)
 	if len(result) != 2 {
 		t.Fatalf("expected 2 results (Winter 2019, Winter 2020), got %d", len(result))
 	}
@@ -1681,7 +1792,7 @@ func TestCalculateSeasonalAvg_MonthlyMeansMethod(t *testing.T) {
 		Date: time.Date(2020, 7, 1, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: 350,
 	})
 
-	result := calculateSeasonalAvg(raw, false)
+	result := calculateSeasonalAvg(newStationData(raw), false, noCompleteness)
 	if len(result) != 1 {
 		t.Fatalf("expected 1 result, got %d", len(result))
 	}
@@ -1697,13 +1808,13 @@ func TestCalculateSeasonalAvg_MonthlyMeansMethod(t *testing.T) {
 func TestFindStationByID(t *testing.T) {
 	lat1, long1 := 52.52, 13.405
 	lat2, long2 := -33.87, 151.21
-	oldStations := allStations
-	defer func() { allStations = oldStations }()
-
-	allStations = []*Station{
-		{ID: "BERLIN01", Name: "Berlin", Latitude: &lat1, Longitude: &long1},
-		{ID: "SYDNEY01", Name: "Sydney", Latitude: &lat2, Longitude: &long2},
-	}
+	setupGlobalState(t,
+		[]*Station{
+			{ID: "BERLIN01", Name: "Berlin", Latitude: &lat1, Longitude: &long1},
+			{ID: "SYDNEY01", Name: "Sydney", Latitude: &lat2, Longitude: &long2},
+		},
+		map[string]*StationInventory{},
+	)
 
 	// Test found
 	s := findStationByID("SYDNEY01")
@@ -1730,12 +1841,12 @@ func TestFindStations_EqualDistanceSorting(t *testing.T) {
 			{ID: "STN_A", Name: "Station A", Latitude: &lat, Longitude: &long},
 		},
 		map[string]*StationInventory{
-			"STN_B": {FirstYear: 1900, LastYear: 2023},
-			"STN_A": {FirstYear: 1900, LastYear: 2023},
+			"STN_B": temperatureInventory(1900, 2023),
+			"STN_A": temperatureInventory(1900, 2023),
 		},
 	)
 
-	result, err := findStations(52.52, 13.405, 100, 10, 1950, 2020)
+	result, err := findStations(52.52, 13.405, 100, 10, stationFilter{StartYear: 1950, EndYear: 2020})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -1760,7 +1871,7 @@ func TestCountStationsInRadius_NoStationsNearby(t *testing.T) {
 		map[string]*StationInventory{},
 	)
 
-	count := countStationsInRadius(52.52, 13.405, 10)
+	count := countStationsInRadius(52.52, 13.405, 10, stationFilter{})
 	if count != 0 {
 		t.Errorf("expected 0 stations in radius, got %d", count)
 	}
@@ -1777,13 +1888,13 @@ func TestCountStationsInRadius_StationsNearby(t *testing.T) {
 			{ID: "STN003", Name: "Far Away", Latitude: &lat3, Longitude: &long3},
 		},
 		map[string]*StationInventory{
-			"STN001": {FirstYear: 1950, LastYear: 2020},
-			"STN002": {FirstYear: 1950, LastYear: 2020},
-			"STN003": {FirstYear: 1950, LastYear: 2020},
+			"STN001": temperatureInventory(1950, 2020),
+			"STN002": temperatureInventory(1950, 2020),
+			"STN003": temperatureInventory(1950, 2020),
 		},
 	)
 
-	count := countStationsInRadius(52.52, 13.405, 50)
+	count := countStationsInRadius(52.52, 13.405, 50, stationFilter{})
 	if count != 2 {
 		t.Errorf("expected 2 stations in radius, got %d", count)
 	}
@@ -1799,7 +1910,7 @@ func TestCountStationsInRadius_SkipsNilLatLong(t *testing.T) {
 		map[string]*StationInventory{},
 	)
 
-	count := countStationsInRadius(52.52, 13.405, 100)
+	count := countStationsInRadius(52.52, 13.405, 100, stationFilter{})
 	if count != 0 {
 		t.Errorf("expected 0 stations (nil coords), got %d", count)
 	}
@@ -1834,7 +1945,7 @@ func TestStationsHandler_StationsExistButNoDataInRange_ReturnsYearMessage(t *tes
 		},
 		map[string]*StationInventory{
 			// Station data only covers 1900-1950, not the requested 2000-2020
-			"STN001": {FirstYear: 1900, LastYear: 1950},
+			"STN001": temperatureInventory(1900, 1950),
 		},
 	)
 
@@ -1870,3 +1981,743 @@ func containsHelper(s, substr string) bool {
 	}
 	return false
 }
+
+// ─── Precipitation / Snow Tests ────────────────────────────────────────────────
+
+func TestCalculateAnnualAvg_PrecipitationIsSummedAndConverted(t *testing.T) {
+	// PRCP is stored in tenths of mm and summed up over the year
+	raw := []RawStationData{
+		{Date: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), ElementType: "PRCP", Value: 25},
+		{Date: time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), ElementType: "PRCP", Value: 0},
+		{Date: time.Date(2020, 7, 1, 0, 0, 0, 0, time.UTC), ElementType: "PRCP", Value: 153},
+	}
+	result := calculateAnnualAvg(newStationData(raw), noCompleteness)
+	if len(result) != 1 {
+		t.Fatalf("expected 1 year, got %d", len(result))
+	}
+	// (25 + 0 + 153) / 10 = 17.8 mm
+	if result[0].Prcp == nil || !approxEqual(*result[0].Prcp, 17.8, 0.001) {
+		t.Errorf("expected Prcp 17.8 mm, got %v", result[0].Prcp)
+	}
+	if result[0].TMin != nil || result[0].TMax != nil {
+		t.Error("expected TMin/TMax nil when only PRCP data provided")
+	}
+}
+
+func TestCalculateAnnualAvg_SnowTotalAndSnowDepthMean(t *testing.T) {
+	// SNOW and SNWD are already in mm; SNOW is summed, SNWD averaged
+	raw := []RawStationData{
+		{Date: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), ElementType: "SNOW", Value: 30},
+		{Date: time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), ElementType: "SNOW", Value: 50},
+		{Date: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), ElementType: "SNWD", Value: 100},
+		{Date: time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), ElementType: "SNWD", Value: 200},
+		{Date: time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC), ElementType: "SNWD", Value: 50},
+	}
+	result := calculateAnnualAvg(newStationData(raw), noCompleteness)
+	if len(result) != 1 {
+		t.Fatalf("expected 1 year, got %d", len(result))
+	}
+	if result[0].Snow == nil || !approxEqual(*result[0].Snow, 80, 0.001) {
+		t.Errorf("expected Snow 80 mm, got %v", result[0].Snow)
+	}
+	// monthly means: Jan=150, Feb=50 -> annual mean 100
+	if result[0].Snwd == nil || !approxEqual(*result[0].Snwd, 100, 0.001) {
+		t.Errorf("expected Snwd 100 mm, got %v", result[0].Snwd)
+	}
+}
+
+func TestCalculateSeasonalAvg_PrecipitationTotal(t *testing.T) {
+	// Winter 2020: Dec 2020 + Jan 2021 + Feb 2021
+	raw := []RawStationData{
+		{Date: time.Date(2020, 12, 15, 0, 0, 0, 0, time.UTC), ElementType: "PRCP", Value: 100},
+		{Date: time.Date(2021, 1, 15, 0, 0, 0, 0, time.UTC), ElementType: "PRCP", Value: 205},
+		{Date: time.Date(2021, 2, 15, 0, 0, 0, 0, time.UTC), ElementType: "PRCP", Value: 50},
+		{Date: time.Date(2021, 2, 16, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: -30},
+	}
+	result := calculateSeasonalAvg(newStationData(raw), false, noCompleteness)
+	if len(result) != 1 {
+		t.Fatalf("expected 1 result, got %d", len(result))
+	}
+	if result[0].Prcp == nil || !approxEqual(*result[0].Prcp, 35.5, 0.001) {
+		t.Errorf("expected Prcp 35.5 mm, got %v", result[0].Prcp)
+	}
+	if result[0].TMin == nil || !approxEqual(*result[0].TMin, -3.0, 0.001) {
+		t.Errorf("expected TMin -3.0, got %v", result[0].TMin)
+	}
+	if result[0].Snow != nil {
+		t.Error("expected Snow nil when no SNOW data provided")
+	}
+}
+
+func TestParseElements(t *testing.T) {
+	elements, err := parseElements("prcp, TMIN,PRCP")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(elements) != 2 || elements[0] != "PRCP" || elements[1] != "TMIN" {
+		t.Errorf("expected [PRCP TMIN], got %v", elements)
+	}
+
+	elements, err = parseElements("")
+	if err != nil || len(elements) != 0 {
+		t.Errorf("expected no elements for empty input, got %v (%v)", elements, err)
+	}
+
+	if _, err := parseElements("TMIN,WIND"); err == nil {
+		t.Error("expected error for unknown element")
+	}
+}
+
+func TestFindStations_FiltersByRequestedElements(t *testing.T) {
+	lat, long := 52.52, 13.405
+	setupGlobalState(t,
+		[]*Station{
+			{ID: "TEMP", Name: "Temperature only", Latitude: &lat, Longitude: &long},
+			{ID: "RAIN", Name: "Precipitation since 1990", Latitude: &lat, Longitude: &long},
+			{ID: "BOTH", Name: "Everything", Latitude: &lat, Longitude: &long},
+		},
+		map[string]*StationInventory{
+			"TEMP": {Elements: map[string]*ElementInventory{
+				"TMIN": {FirstYear: 1900, LastYear: 2023},
+				"TMAX": {FirstYear: 1900, LastYear: 2023},
+			}},
+			"RAIN": {Elements: map[string]*ElementInventory{
+				"PRCP": {FirstYear: 1990, LastYear: 2023},
+			}},
+			"BOTH": {Elements: map[string]*ElementInventory{
+				"TMIN": {FirstYear: 1900, LastYear: 2023},
+				"TMAX": {FirstYear: 1900, LastYear: 2023},
+				"PRCP": {FirstYear: 1900, LastYear: 2023},
+			}},
+		},
+	)
+
+	// default: TMIN/TMAX range, precipitation-only stations are ignored
+	result, _ := findStations(52.52, 13.405, 100, 10, stationFilter{StartYear: 1950, EndYear: 2020})
+	if len(result) != 2 {
+		t.Errorf("expected 2 temperature stations, got %d", len(result))
+	}
+
+	result, _ = findStations(52.52, 13.405, 100, 10, stationFilter{StartYear: 1950, EndYear: 2020, Elements: []string{"PRCP"}})
+	if len(result) != 1 || result[0].ID != "BOTH" {
+		t.Errorf("expected only BOTH with PRCP since 1950, got %v", result)
+	}
+
+	result, _ = findStations(52.52, 13.405, 100, 10, stationFilter{StartYear: 2000, EndYear: 2020, Elements: []string{"PRCP"}})
+	if len(result) != 2 {
+		t.Errorf("expected 2 stations with PRCP since 2000, got %d", len(result))
+	}
+
+	if count := countStationsInRadius(52.52, 13.405, 100, stationFilter{Elements: []string{"PRCP"}}); count != 2 {
+		t.Errorf("expected 2 stations with PRCP in radius, got %d", count)
+	}
+	if count := countStationsInRadius(52.52, 13.405, 100, stationFilter{}); count != 2 {
+		t.Errorf("expected 2 stations with TMIN/TMAX in radius, got %d", count)
+	}
+}
+
+func TestStationsHandler_InvalidElements(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/stations?lat=52&long=13&radius=100&limit=10&start=1950&end=2020&elements=TMIN,FOO", nil)
+	rec := httptest.NewRecorder()
+
+	stationsHandler(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", rec.Code)
+	}
+}
+
+// ─── Monthly Aggregation Tests ─────────────────────────────────────────────────
+
+func TestCalculateMonthly_MeansAndCounts(t *testing.T) {
+	raw := []RawStationData{
+		{Date: time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: 10},
+		{Date: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: -20},
+		{Date: time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: -40},
+		{Date: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), ElementType: "TMAX", Value: 55},
+		{Date: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), ElementType: "PRCP", Value: 12},
+		{Date: time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), ElementType: "PRCP", Value: 30},
+		{Date: time.Date(2019, 12, 31, 0, 0, 0, 0, time.UTC), ElementType: "TMAX", Value: 20},
+	}
+
+	result := calculateMonthly(newStationData(raw))
+	if len(result) != 3 {
+		t.Fatalf("expected 3 months, got %d", len(result))
+	}
+
+	// sorted by year, then month
+	if result[0].Year != 2019 || result[0].Month != 12 {
+		t.Errorf("pos 0: expected 2019-12, got %d-%d", result[0].Year, result[0].Month)
+	}
+	if result[1].Year != 2020 || result[1].Month != 1 {
+		t.Errorf("pos 1: expected 2020-01, got %d-%d", result[1].Year, result[1].Month)
+	}
+
+	jan := result[1]
+	if jan.TMin == nil || !approxEqual(*jan.TMin, -3.0, 0.001) {
+		t.Errorf("expected Jan TMin -3.0, got %v", jan.TMin)
+	}
+	if jan.TMax == nil || !approxEqual(*jan.TMax, 5.5, 0.001) {
+		t.Errorf("expected Jan TMax 5.5, got %v", jan.TMax)
+	}
+	if jan.Prcp == nil || !approxEqual(*jan.Prcp, 4.2, 0.001) {
+		t.Errorf("expected Jan Prcp 4.2 mm, got %v", jan.Prcp)
+	}
+	if jan.TMinCount != 2 || jan.TMaxCount != 1 || jan.PrcpCount != 2 || jan.SnowCount != 0 {
+		t.Errorf("unexpected counts: tmin=%d tmax=%d prcp=%d snow=%d",
+			jan.TMinCount, jan.TMaxCount, jan.PrcpCount, jan.SnowCount)
+	}
+	if jan.Snow != nil {
+		t.Error("expected Snow nil without SNOW data")
+	}
+	if result[2].TMax != nil {
+		t.Error("expected Feb TMax nil without TMAX data")
+	}
+}
+
+func TestMonthlyHandler_MissingID(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/station/monthly", nil)
+	rec := httptest.NewRecorder()
+
+	monthlyHandler(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", rec.Code)
+	}
+}
+
+func TestMonthlyHandler_ReturnsMonths(t *testing.T) {
+	setupCache(t)
+
+	rawData := []RawStationData{
+		{Date: time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: -50},
+		{Date: time.Date(2020, 7, 15, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: 180},
+	}
+	cache.put("TESTSTATION", newStationData(rawData), stationVersion{}, time.Now())
+
+	req := httptest.NewRequest(http.MethodGet, "/station/monthly?id=TESTSTATION", nil)
+	rec := httptest.NewRecorder()
+
+	monthlyHandler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", rec.Code)
+	}
+	var resp struct {
+		Data     []MonthlyStationData `json:"data"`
+		ErrorMsg string               `json:"errorMessage"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp.Data) != 2 {
+		t.Fatalf("expected 2 months, got %d", len(resp.Data))
+	}
+	if resp.Data[1].Month != 7 || resp.Data[1].TMinCount != 1 {
+		t.Errorf("unexpected July entry: %+v", resp.Data[1])
+	}
+}
+
+// ─── Daily Observation Tests ───────────────────────────────────────────────────
+
+func TestFilterDaily_DateRangeAndElements(t *testing.T) {
+	raw := []RawStationData{
+		{Date: time.Date(2020, 7, 2, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: 180},
+		{Date: time.Date(2020, 7, 1, 0, 0, 0, 0, time.UTC), ElementType: "TMAX", Value: 330},
+		{Date: time.Date(2020, 7, 1, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: 170},
+		{Date: time.Date(2020, 7, 1, 0, 0, 0, 0, time.UTC), ElementType: "PRCP", Value: 12},
+		{Date: time.Date(2020, 6, 30, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: 160},
+		{Date: time.Date(2020, 7, 3, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: 190},
+	}
+	from := time.Date(2020, 7, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2020, 7, 2, 0, 0, 0, 0, time.UTC)
+
+	result := filterDaily(newStationData(raw), from, to, []string{"TMIN", "TMAX"})
+	if len(result) != 3 {
+		t.Fatalf("expected 3 values, got %d", len(result))
+	}
+	// sorted by date, then TMIN before TMAX
+	if result[0].ElementType != "TMIN" || result[1].ElementType != "TMAX" || result[2].Value != 180 {
+		t.Errorf("unexpected order: %+v", result)
+	}
+
+	// no restriction returns everything
+	if all := filterDaily(newStationData(raw), time.Time{}, time.Time{}, nil); len(all) != len(raw) {
+		t.Errorf("expected %d values without filters, got %d", len(raw), len(all))
+	}
+}
+
+func TestDailyHandler_ConvertsAndPaginates(t *testing.T) {
+	setupCache(t)
+
+	var rawData []RawStationData
+	for day := 1; day <= 10; day++ {
+		rawData = append(rawData, RawStationData{
+			Date: time.Date(2020, 7, day, 0, 0, 0, 0, time.UTC), ElementType: "TMAX", Value: 300 + day,
+		})
+	}
+	rawData = append(rawData, RawStationData{
+		Date: time.Date(2020, 7, 5, 0, 0, 0, 0, time.UTC), ElementType: "PRCP", Value: 47,
+	})
+	cache.put("TESTSTATION", newStationData(rawData), stationVersion{}, time.Now())
+
+	req := httptest.NewRequest(http.MethodGet, "/station/daily?id=TESTSTATION&from=2020-07-03&to=2020-07-08&elements=TMAX&limit=2&offset=1", nil)
+	rec := httptest.NewRecorder()
+	dailyHandler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var resp struct {
+		Data     DailyStationResponse `json:"data"`
+		ErrorMsg string               `json:"errorMessage"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Data.Total != 6 {
+		t.Errorf("expected total 6, got %d", resp.Data.Total)
+	}
+	if len(resp.Data.Observations) != 2 {
+		t.Fatalf("expected 2 observations on page, got %d", len(resp.Data.Observations))
+	}
+	first := resp.Data.Observations[0]
+	if first.Date != "2020-07-04" || first.Element != "TMAX" || !approxEqual(first.Value, 30.4, 0.001) {
+		t.Errorf("unexpected first observation: %+v", first)
+	}
+
+	// precipitation is converted from tenths of mm
+	req = httptest.NewRequest(http.MethodGet, "/station/daily?id=TESTSTATION&elements=PRCP", nil)
+	rec = httptest.NewRecorder()
+	dailyHandler(rec, req)
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if len(resp.Data.Observations) != 1 || !approxEqual(resp.Data.Observations[0].Value, 4.7, 0.001) {
+		t.Errorf("expected one PRCP value of 4.7 mm, got %+v", resp.Data.Observations)
+	}
+}
+
+func TestDailyHandler_InvalidParams(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"missing id", "?from=2020-01-01"},
+		{"invalid from", "?id=STN&from=2020-13-01"},
+		{"invalid to", "?id=STN&to=01.01.2020"},
+		{"to before from", "?id=STN&from=2020-02-01&to=2020-01-01"},
+		{"invalid elements", "?id=STN&elements=FOO"},
+		{"limit too large", "?id=STN&limit=100000"},
+		{"negative offset", "?id=STN&offset=-1"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/station/daily"+tc.query, nil)
+			rec := httptest.NewRecorder()
+
+			dailyHandler(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("expected 400, got %d", rec.Code)
+			}
+		})
+	}
+}
+
+// ─── Quality Flag Tests ────────────────────────────────────────────────────────
+
+func TestLoadStationData_ParsesFlags(t *testing.T) {
+	csvData := `"ID","DATE","ELEMENT","DATA_VALUE","M_FLAG","Q_FLAG","S_FLAG","OBS_TIME"
+"STN001","20200101","TMIN",100,"","","S","0700"
+"STN001","20200102","TMIN",999,"","X","7","0700"
+"STN001","20200103","PRCP",0,"T","","S",""
+`
+	server := newMockS3Server(map[string]string{"STN001": csvData})
+	defer server.Close()
+
+	data, _, err := loadStationData(&httpSource{baseURL: server.URL}, "STN001", stationVersion{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	result := allRows(data)
+	if len(result) != 3 {
+		t.Fatalf("expected 3 records (flagged values are kept while parsing), got %d", len(result))
+	}
+	if result[0].MFlag != 0 || result[0].QFlag != 0 || result[0].SFlag != 'S' {
+		t.Errorf("record 0: unexpected flags %q/%q/%q", result[0].MFlag, result[0].QFlag, result[0].SFlag)
+	}
+	if result[1].QFlag != 'X' || result[1].SFlag != '7' {
+		t.Errorf("record 1: expected Q-flag X and S-flag 7, got %q/%q", result[1].QFlag, result[1].SFlag)
+	}
+	if result[2].MFlag != 'T' {
+		t.Errorf("record 2: expected M-flag T (trace), got %q", result[2].MFlag)
+	}
+}
+
+func TestApplyQCFilter(t *testing.T) {
+	raw := []RawStationData{
+		{Date: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: 100},
+		{Date: time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: 999, QFlag: 'X'},
+		{Date: time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: 110, QFlag: 'D'},
+	}
+
+	if got := applyQCFilter(newStationData(raw), qcFilter{}); got.len() != 1 {
+		t.Errorf("default: expected all flagged values dropped, got %d values", got.len())
+	}
+	if got := applyQCFilter(newStationData(raw), qcFilter{includeFlagged: true}); got.len() != 3 {
+		t.Errorf("includeFlagged: expected 3 values, got %d", got.len())
+	}
+	got := applyQCFilter(newStationData(raw), qcFilter{excludeFlags: "X"})
+	if got.len() != 2 || allRows(got)[1].QFlag != 'D' {
+		t.Errorf("excludeFlags=X: expected the D-flagged value to be kept, got %+v", allRows(got))
+	}
+	// the flagged outlier no longer distorts the mean
+	annual := calculateAnnualAvg(applyQCFilter(newStationData(raw), qcFilter{}), noCompleteness)
+	if !approxEqual(*annual[0].TMin, 10.0, 0.001) {
+		t.Errorf("expected TMin 10.0 without flagged values, got %f", *annual[0].TMin)
+	}
+}
+
+func TestParseQCFilter(t *testing.T) {
+	f, err := parseQCFilter(url.Values{"includeFlagged": {"true"}})
+	if err != nil || !f.includeFlagged {
+		t.Errorf("expected includeFlagged, got %+v (%v)", f, err)
+	}
+	f, err = parseQCFilter(url.Values{"qflags": {"d, g"}})
+	if err != nil || f.excludeFlags != "DG" {
+		t.Errorf("expected excludeFlags DG, got %+v (%v)", f, err)
+	}
+	if _, err := parseQCFilter(url.Values{"qflags": {"Q"}}); err == nil {
+		t.Error("expected error for unknown quality flag")
+	}
+	if _, err := parseQCFilter(url.Values{"includeFlagged": {"maybe"}}); err == nil {
+		t.Error("expected error for invalid includeFlagged value")
+	}
+}
+
+func TestStationHandler_ExcludesFlaggedValuesByDefault(t *testing.T) {
+	setupCache(t)
+
+	rawData := []RawStationData{
+		{Date: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), ElementType: "TMAX", Value: 100},
+		{Date: time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), ElementType: "TMAX", Value: 900, QFlag: 'G'},
+	}
+	cache.put("TESTSTATION", newStationData(rawData), stationVersion{}, time.Now())
+
+	decode := func(query string) StationDetailResponse {
+		req := httptest.NewRequest(http.MethodGet, "/station?id=TESTSTATION&completeness=false"+query, nil)
+		rec := httptest.NewRecorder()
+		stationHandler(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", query, rec.Code)
+		}
+		var resp struct {
+			Data StationDetailResponse `json:"data"`
+		}
+		json.NewDecoder(rec.Body).Decode(&resp)
+		return resp.Data
+	}
+
+	if data := decode(""); !approxEqual(*data.Annual[0].TMax, 10.0, 0.001) {
+		t.Errorf("default: expected TMax 10.0, got %f", *data.Annual[0].TMax)
+	}
+	if data := decode("&includeFlagged=true"); !approxEqual(*data.Annual[0].TMax, 50.0, 0.001) {
+		t.Errorf("includeFlagged: expected TMax 50.0, got %f", *data.Annual[0].TMax)
+	}
+	if data := decode("&qflags=D"); !approxEqual(*data.Annual[0].TMax, 50.0, 0.001) {
+		t.Errorf("qflags=D: expected G-flagged value kept, got %f", *data.Annual[0].TMax)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/station?id=TESTSTATION&qflags=1", nil)
+	rec := httptest.NewRecorder()
+	stationHandler(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid qflags, got %d", rec.Code)
+	}
+}
+
+// ─── Completeness Tests ────────────────────────────────────────────────────────
+
+// fullMonth returns one value per day of the month, skipping the given days.
+func fullMonth(year int, month time.Month, element string, value int, skip ...int) []RawStationData {
+	var raw []RawStationData
+	for day := 1; day <= daysIn(year, month); day++ {
+		if slices.Contains(skip, day) {
+			continue
+		}
+		raw = append(raw, RawStationData{
+			Date: time.Date(year, month, day, 0, 0, 0, 0, time.UTC), ElementType: element, Value: value,
+		})
+	}
+	return raw
+}
+
+func TestMonthAggr_Complete(t *testing.T) {
+	tests := []struct {
+		name     string
+		skip     []int
+		expected bool
+	}{
+		{"all days", nil, true},
+		{"10 scattered days missing", []int{1, 3, 5, 7, 9, 11, 13, 15, 17, 19}, true},
+		{"11 days missing", []int{1, 3, 5, 7, 9, 11, 13, 15, 17, 19, 21}, false},
+		{"5 consecutive days missing", []int{10, 11, 12, 13, 14}, true},
+		{"6 consecutive days missing", []int{10, 11, 12, 13, 14, 15}, false},
+		{"last 6 days missing", []int{26, 27, 28, 29, 30, 31}, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m := aggregateMonths(newStationData(fullMonth(2020, time.January, "TMIN", 10, tc.skip...)))[monthKey{2020, time.January}]
+			if got := m.complete("TMIN", defaultCompleteness); got != tc.expected {
+				t.Errorf("expected complete=%v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestCalculateAnnualAvg_WMORules_IncompleteYearHasNoMean(t *testing.T) {
+	// 2019: every month complete, 2020: a single observation
+	var raw []RawStationData
+	for m := time.January; m <= time.December; m++ {
+		raw = append(raw, fullMonth(2019, m, "TMAX", int(m)*10)...)
+	}
+	raw = append(raw, RawStationData{
+		Date: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), ElementType: "TMAX", Value: 500,
+	})
+
+	result := calculateAnnualAvg(newStationData(raw), defaultCompleteness)
+	if len(result) != 2 {
+		t.Fatalf("expected 2 years, got %d", len(result))
+	}
+	// (10+20+...+120)/12 = 65 -> 6.5
+	if result[0].TMax == nil || !approxEqual(*result[0].TMax, 6.5, 0.001) {
+		t.Errorf("2019: expected TMax 6.5, got %v", result[0].TMax)
+	}
+	if result[0].Coverage["TMAX"] != 100 {
+		t.Errorf("2019: expected coverage 100%%, got %v", result[0].Coverage["TMAX"])
+	}
+	if result[1].TMax != nil {
+		t.Errorf("2020: expected no TMax for a single observation, got %f", *result[1].TMax)
+	}
+	// 1 of 366 days -> 0.3 %
+	if !approxEqual(result[1].Coverage["TMAX"], 0.3, 0.001) {
+		t.Errorf("2020: expected coverage 0.3%%, got %v", result[1].Coverage["TMAX"])
+	}
+}
+
+func TestCalculateAnnualAvg_CustomMinMonths(t *testing.T) {
+	raw := append(fullMonth(2020, time.January, "TMIN", 0), fullMonth(2020, time.February, "TMIN", 20)...)
+	// March is incomplete and must not be used
+	raw = append(raw, fullMonth(2020, time.March, "TMIN", 500, 1, 2, 3, 4, 5, 6)...)
+
+	rules := defaultCompleteness
+	rules.MinMonthsPerYear = 2
+	result := calculateAnnualAvg(newStationData(raw), rules)
+	if result[0].TMin == nil || !approxEqual(*result[0].TMin, 1.0, 0.001) {
+		t.Errorf("expected TMin 1.0 from Jan and Feb only, got %v", result[0].TMin)
+	}
+
+	rules.MinMonthsPerYear = 3
+	if result := calculateAnnualAvg(newStationData(raw), rules); result[0].TMin != nil {
+		t.Errorf("expected no TMin with only 2 complete months, got %f", *result[0].TMin)
+	}
+}
+
+func TestCalculateSeasonalAvg_WMORules(t *testing.T) {
+	// Winter 2019 (Dec 2019, Jan+Feb 2020 leap year) complete, Spring 2020 misses May
+	var raw []RawStationData
+	raw = append(raw, fullMonth(2019, time.December, "TMIN", -30)...)
+	raw = append(raw, fullMonth(2020, time.January, "TMIN", -60)...)
+	raw = append(raw, fullMonth(2020, time.February, "TMIN", 0)...)
+	raw = append(raw, fullMonth(2020, time.March, "TMIN", 20)...)
+	raw = append(raw, fullMonth(2020, time.April, "TMIN", 50)...)
+
+	result := calculateSeasonalAvg(newStationData(raw), false, defaultCompleteness)
+	if len(result) != 2 {
+		t.Fatalf("expected 2 seasons, got %d", len(result))
+	}
+	winter, spring := result[0], result[1]
+	if winter.TMin == nil || !approxEqual(*winter.TMin, -3.0, 0.001) {
+		t.Errorf("winter: expected TMin -3.0, got %v", winter.TMin)
+	}
+	if winter.Coverage["TMIN"] != 100 {
+		t.Errorf("winter: expected coverage 100%% (91 days), got %v", winter.Coverage["TMIN"])
+	}
+	if spring.TMin != nil {
+		t.Errorf("spring: expected no TMin without May, got %f", *spring.TMin)
+	}
+	// 61 of 92 days
+	if !approxEqual(spring.Coverage["TMIN"], 66.3, 0.001) {
+		t.Errorf("spring: expected coverage 66.3%%, got %v", spring.Coverage["TMIN"])
+	}
+}
+
+func TestSeasonDays(t *testing.T) {
+	if d := seasonDays(2019, "Winter", false); d != 91 {
+		t.Errorf("expected 91 days for winter 2019/20, got %d", d)
+	}
+	if d := seasonDays(2020, "Winter", false); d != 90 {
+		t.Errorf("expected 90 days for winter 2020/21, got %d", d)
+	}
+	if d := seasonDays(2020, "Summer", true); d != 90 {
+		t.Errorf("expected 90 days for southern summer 2020/21, got %d", d)
+	}
+	if d := seasonDays(2020, "Summer", false); d != 92 {
+		t.Errorf("expected 92 days for northern summer, got %d", d)
+	}
+}
+
+func TestParseCompleteness(t *testing.T) {
+	rules, err := parseCompleteness(url.Values{})
+	if err != nil || rules != defaultCompleteness {
+		t.Errorf("expected WMO defaults, got %+v (%v)", rules, err)
+	}
+	rules, err = parseCompleteness(url.Values{"completeness": {"false"}})
+	if err != nil || rules != noCompleteness {
+		t.Errorf("expected rules disabled, got %+v (%v)", rules, err)
+	}
+	rules, err = parseCompleteness(url.Values{"maxMissingDays": {"5"}, "minMonths": {"10"}})
+	if err != nil || rules.MaxMissingDays != 5 || rules.MinMonthsPerYear != 10 || rules.MaxConsecutiveMissing != 5 {
+		t.Errorf("expected overridden rules, got %+v (%v)", rules, err)
+	}
+	if _, err := parseCompleteness(url.Values{"minMonths": {"13"}}); err == nil {
+		t.Error("expected error for minMonths > 12")
+	}
+	if _, err := parseCompleteness(url.Values{"completeness": {"sometimes"}}); err == nil {
+		t.Error("expected error for invalid completeness value")
+	}
+}
+
+// ─── Station Metadata Tests ────────────────────────────────────────────────────
+
+func TestParseStationLine(t *testing.T) {
+	s := parseStationLine("USW00094728  40.7789  -73.9692   39.6 NY NEW YORK CNTRL PK TWR              HCN 72506")
+	if s == nil {
+		t.Fatal("expected a station")
+	}
+	if s.ID != "USW00094728" || s.Name != "NEW YORK CNTRL PK TWR" || s.State != "NY" || s.WMOID != "72506" {
+		t.Errorf("unexpected station %+v", s)
+	}
+	if !approxEqual(*s.Latitude, 40.7789, 0.0001) || !approxEqual(*s.Longitude, -73.9692, 0.0001) {
+		t.Errorf("unexpected coordinates %v %v", *s.Latitude, *s.Longitude)
+	}
+	if s.Elevation == nil || !approxEqual(*s.Elevation, 39.6, 0.01) {
+		t.Errorf("expected elevation 39.6, got %v", s.Elevation)
+	}
+	if !slices.Equal(s.Networks, []string{"HCN"}) {
+		t.Errorf("expected HCN network, got %v", s.Networks)
+	}
+
+	s = parseStationLine("GM000003342  48.1500   11.5500  515.0    MUENCHEN                       GSN     10865")
+	if s.State != "" || s.Name != "MUENCHEN" || !slices.Equal(s.Networks, []string{"GSN"}) || s.WMOID != "10865" {
+		t.Errorf("unexpected station %+v", s)
+	}
+
+	// missing elevation, line without flags
+	s = parseStationLine("AQC00914000 -14.3167 -170.7667 -999.9 AS AASUFOU")
+	if s == nil || s.Elevation != nil || s.Name != "AASUFOU" || len(s.Networks) != 0 || s.WMOID != "" {
+		t.Errorf("unexpected station %+v", s)
+	}
+
+	if s.Country != "AQ" {
+		t.Errorf("expected country AQ, got %q", s.Country)
+	}
+
+	if parseStationLine("too short") != nil {
+		t.Error("expected nil for a short line")
+	}
+}
+
+func TestFindStations_MetadataFilter(t *testing.T) {
+	lowLat, lowLong, lowElev := 52.52, 13.405, 34.0
+	highLat, highLong, highElev := 52.6, 13.5, 1200.0
+	unknownLat, unknownLong := 52.55, 13.45
+	setupGlobalState(t,
+		[]*Station{
+			{ID: "LOW", Latitude: &lowLat, Longitude: &lowLong, Elevation: &lowElev, Networks: []string{"GSN"}},
+			{ID: "HIGH", Latitude: &highLat, Longitude: &highLong, Elevation: &highElev, Networks: []string{"GSN", "HCN"}},
+			{ID: "UNKNOWN", Latitude: &unknownLat, Longitude: &unknownLong},
+		},
+		map[string]*StationInventory{
+			"LOW":     temperatureInventory(1900, 2023),
+			"HIGH":    temperatureInventory(1900, 2023),
+			"UNKNOWN": temperatureInventory(1900, 2023),
+		},
+	)
+
+	minElev, maxElev := 500.0, 100.0
+	tests := []struct {
+		name   string
+		filter stationFilter
+		want   []string
+	}{
+		{"no filter", stationFilter{}, []string{"LOW", "UNKNOWN", "HIGH"}},
+		{"min elevation", stationFilter{MinElevation: &minElev}, []string{"HIGH"}},
+		{"max elevation", stationFilter{MaxElevation: &maxElev}, []string{"LOW"}},
+		{"GSN", stationFilter{Networks: []string{"GSN"}}, []string{"LOW", "HIGH"}},
+		{"GSN and HCN", stationFilter{Networks: []string{"GSN", "HCN"}}, []string{"HIGH"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.filter.StartYear, tc.filter.EndYear = 1950, 2020
+			result, _ := findStations(52.52, 13.405, 100, 10, tc.filter)
+			var ids []string
+			for _, s := range result {
+				ids = append(ids, s.ID)
+			}
+			if !slices.Equal(ids, tc.want) {
+				t.Errorf("expected %v, got %v", tc.want, ids)
+			}
+		})
+	}
+
+	// the metadata is returned with the stations
+	result, _ := findStations(52.52, 13.405, 1, 10, stationFilter{StartYear: 1950, EndYear: 2020})
+	if len(result) != 1 || result[0].Elevation == nil || *result[0].Elevation != 34 || result[0].Networks[0] != "GSN" {
+		t.Errorf("expected LOW with metadata, got %+v", result)
+	}
+}
+
+func TestParseStationFilter(t *testing.T) {
+	f, err := parseStationFilter(url.Values{"minElevation": {"100"}, "maxElevation": {"500.5"}, "network": {"gsn, HCN"}, "elements": {"PRCP"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *f.MinElevation != 100 || *f.MaxElevation != 500.5 || !slices.Equal(f.Networks, []string{"GSN", "HCN"}) || !slices.Equal(f.Elements, []string{"PRCP"}) {
+		t.Errorf("unexpected filter %+v", f)
+	}
+
+	for _, q := range []url.Values{
+		{"minElevation": {"abc"}},
+		{"minElevation": {"500"}, "maxElevation": {"100"}},
+		{"network": {"XYZ"}},
+		{"elements": {"TAVG"}},
+	} {
+		if _, err := parseStationFilter(q); err == nil {
+			t.Errorf("%v: expected error", q)
+		}
+	}
+}
+
+// the docker build compiles the sources left in the build context
+func TestDockerignoreKeepsSources(t *testing.T) {
+	content, err := os.ReadFile(".dockerignore")
+	if err != nil {
+		t.Fatalf("reading .dockerignore: %v", err)
+	}
+	sources, _ := filepath.Glob("*.go")
+	for _, pattern := range strings.Split(string(content), "\n") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" || strings.HasPrefix(pattern, "#") || strings.HasPrefix(pattern, "!") {
+			continue
+		}
+		for _, name := range sources {
+			if strings.HasSuffix(name, "_test.go") {
+				continue
+			}
+			if ok, _ := filepath.Match(pattern, name); ok {
+				t.Errorf("%s is excluded from the docker build by %q", name, pattern)
+			}
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// default WMO reference period
+const (
+	defaultNormalsFrom = 1991
+	defaultNormalsTo   = 2020
+)
+
+// share of the reference years that must have a valid value (WMO: 80 %)
+const minNormalsFraction = 0.8
+
+// NormalValue is the mean over all valid years of the reference period,
+// together with the number of years it is based on.
+type NormalValue struct {
+	TMin      *float64 `json:"tmin"`
+	TMax      *float64 `json:"tmax"`
+	TMinYears int      `json:"tminYears"`
+	TMaxYears int      `json:"tmaxYears"`
+}
+
+type MonthlyNormal struct {
+	Month int `json:"month"`
+	NormalValue
+}
+
+type SeasonalNormal struct {
+	Season string `json:"season"`
+	NormalValue
+}
+
+type StationNormalsResponse struct {
+	From     int               `json:"from"`
+	To       int               `json:"to"`
+	MinYears int               `json:"minYears"`
+	Monthly  []*MonthlyNormal  `json:"monthly"`
+	Seasonal []*SeasonalNormal `json:"seasonal"`
+	Annual   *NormalValue      `json:"annual"`
+}
+
+// normalAggr collects the yearly values of one normal
+type normalAggr struct {
+	tmin, tmax []float64
+}
+
+func (n *normalAggr) add(tmin *float64, tmax *float64) {
+	if tmin != nil {
+		n.tmin = append(n.tmin, *tmin)
+	}
+	if tmax != nil {
+		n.tmax = append(n.tmax, *tmax)
+	}
+}
+
+// value averages the collected years, values with fewer than minYears stay nil
+func (n *normalAggr) value(minYears int) NormalValue {
+	return NormalValue{
+		TMin:      meanOf(n.tmin, minYears),
+		TMax:      meanOf(n.tmax, minYears),
+		TMinYears: len(n.tmin),
+		TMaxYears: len(n.tmax),
+	}
+}
+
+// meanOf returns the mean rounded to one decimal, nil with fewer than minCount values
+func meanOf(values []float64, minCount int) *float64 {
+	if len(values) == 0 || len(values) < minCount {
+		return nil
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	avg := math.Round(sum/float64(len(values))*10) / 10
+	return &avg
+}
+
+// defaultMinNormalsYears returns the number of valid years required for a
+// normal of the given reference period.
+func defaultMinNormalsYears(from int, to int) int {
+	return int(math.Ceil(float64(to-from+1) * minNormalsFraction))
+}
+
+// calculateNormals computes monthly, seasonal and annual TMIN/TMAX normals for
+// the reference period from–to. Only months, seasons and years passing the
+// completeness rules are used. Seasons containing January are attributed to
+// the year of January, so DJF 1991 starts in December 1990.
+func calculateNormals(data *stationData, from int, to int, minYears int, southernHemisphere bool, rules completenessRules) *StationNormalsResponse {
+	monthly := make(map[time.Month]*normalAggr)
+	for m := time.January; m <= time.December; m++ {
+		monthly[m] = &normalAggr{}
+	}
+	for key, m := range aggregateMonths(data) {
+		if key.year < from || key.year > to {
+			continue
+		}
+		// monthly means are in tenths of °C
+		var tmin, tmax *float64
+		if m.complete("TMIN", rules) {
+			v, _ := m.value("TMIN")
+			v = v / elementScale("TMIN")
+			tmin = &v
+		}
+		if m.complete("TMAX", rules) {
+			v, _ := m.value("TMAX")
+			v = v / elementScale("TMAX")
+			tmax = &v
+		}
+		monthly[key.month].add(tmin, tmax)
+	}
+
+	seasonal := make(map[string]*normalAggr)
+	for _, s := range calculateSeasonalAvg(data, southernHemisphere, rules) {
+		if year := seasonReferenceYear(s, southernHemisphere); year < from || year > to {
+			continue
+		}
+		if _, ok := seasonal[s.Season]; !ok {
+			seasonal[s.Season] = &normalAggr{}
+		}
+		seasonal[s.Season].add(s.TMin, s.TMax)
+	}
+
+	annual := &normalAggr{}
+	for _, a := range calculateAnnualAvg(data, rules) {
+		if a.Year >= from && a.Year <= to {
+			annual.add(a.TMin, a.TMax)
+		}
+	}
+
+	result := &StationNormalsResponse{From: from, To: to, MinYears: minYears}
+	for m := time.January; m <= time.December; m++ {
+		result.Monthly = append(result.Monthly, &MonthlyNormal{Month: int(m), NormalValue: monthly[m].value(minYears)})
+	}
+	for _, season := range []string{"Winter", "Spring", "Summer", "Autumn"} {
+		n, ok := seasonal[season]
+		if !ok {
+			n = &normalAggr{}
+		}
+		result.Seasonal = append(result.Seasonal, &SeasonalNormal{Season: season, NormalValue: n.value(minYears)})
+	}
+	annualValue := annual.value(minYears)
+	result.Annual = &annualValue
+	return result
+}
+
+// seasonReferenceYear returns the year a season counts for in a reference
+// period. The season containing January is labeled with December's year but
+// belongs to the year of January (WMO convention, DJF 1991 = Dec 1990–Feb 1991).
+func seasonReferenceYear(s *SeasonalStationData, southernHemisphere bool) int {
+	if s.Season == seasonName(time.January, southernHemisphere) {
+		return s.Year + 1
+	}
+	return s.Year
+}
+
+// seasonName returns the name of the season a month belongs to
+func seasonName(month time.Month, southernHemisphere bool) string {
+	_, season := seasonOf(2000, month, southernHemisphere)
+	return season
+}
+
+// parseNormalsPeriod reads the from/to reference years, defaulting to 1991–2020.
+func parseNormalsPeriod(q url.Values) (int, int, error) {
+	from, to := defaultNormalsFrom, defaultNormalsTo
+	var err error
+	if s := q.Get("from"); s != "" {
+		if from, err = strconv.Atoi(s); err != nil {
+			return 0, 0, fmt.Errorf("invalid from year %q", s)
+		}
+	}
+	if s := q.Get("to"); s != "" {
+		if to, err = strconv.Atoi(s); err != nil {
+			return 0, 0, fmt.Errorf("invalid to year %q", s)
+		}
+	}
+	if to < from {
+		return 0, 0, fmt.Errorf("from year %d is after to year %d", from, to)
+	}
+	return from, to, nil
+}
+
+func normalsHandler(w http.ResponseWriter, r *http.Request) {
+	//cors handling
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+	q := r.URL.Query()
+	id := q.Get("id")
+	enc := json.NewEncoder(w)
+
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		response := Response{Data: nil, ErrorMsg: "Please provide a valid station ID."}
+		enc.Encode(response)
+		return
+	}
+	from, to, err := parseNormalsPeriod(q)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := Response{Data: nil, ErrorMsg: "Please provide a valid reference period (from/to years)."}
+		enc.Encode(response)
+		return
+	}
+	minYears := defaultMinNormalsYears(from, to)
+	if s := q.Get("minYears"); s != "" {
+		minYears, err = strconv.Atoi(s)
+		if err != nil || minYears < 1 || minYears > to-from+1 {
+			w.WriteHeader(http.StatusBadRequest)
+			response := Response{Data: nil, ErrorMsg: fmt.Sprintf("Please provide minYears between 1 and %d.", to-from+1)}
+			enc.Encode(response)
+			return
+		}
+	}
+	qc, err := parseQCFilter(q)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := Response{Data: nil, ErrorMsg: "Please provide valid quality flag options (includeFlagged=true|false, qflags=D,G,...)."}
+		enc.Encode(response)
+		return
+	}
+	rules, err := parseCompleteness(q)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response := Response{Data: nil, ErrorMsg: fmt.Sprintf("Please provide valid completeness rules: %v.", err)}
+		enc.Encode(response)
+		return
+	}
+
+	rawData, err := getStationData(id)
+	if err != nil {
+		w.WriteHeader(fetchErrorStatus(err))
+		response := Response{Data: nil, ErrorMsg: err.Error()}
+		enc.Encode(response)
+		return
+	}
+
+	normals := calculateNormals(applyQCFilter(rawData, qc), from, to, minYears, stationInSouthernHemisphere(id), rules)
+	response := Response{Data: normals, ErrorMsg: ""}
+	enc.Encode(response)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// completeYears returns complete daily TMIN/TMAX data for the given years.
+// tmin/tmax are functions of year and month returning tenths of °C.
+func completeYears(from int, to int, tmin func(int, time.Month) int, tmax func(int, time.Month) int) []RawStationData {
+	var raw []RawStationData
+	for year := from; year <= to; year++ {
+		for m := time.January; m <= time.December; m++ {
+			raw = append(raw, fullMonth(year, m, "TMIN", tmin(year, m))...)
+			raw = append(raw, fullMonth(year, m, "TMAX", tmax(year, m))...)
+		}
+	}
+	return raw
+}
+
+func TestCalculateNormals_MonthlySeasonalAnnual(t *testing.T) {
+	// TMIN = month * 10 (1.0 °C in Jan ... 12.0 °C in Dec), TMAX alternates by year
+	raw := completeYears(2000, 2009,
+		func(y int, m time.Month) int { return int(m) * 10 },
+		func(y int, m time.Month) int { return 200 + (y%2)*20 },
+	)
+
+	normals := calculateNormals(newStationData(raw), 2001, 2008, 8, false, defaultCompleteness)
+	if normals.From != 2001 || normals.To != 2008 {
+		t.Errorf("unexpected period %d–%d", normals.From, normals.To)
+	}
+	if len(normals.Monthly) != 12 {
+		t.Fatalf("expected 12 monthly normals, got %d", len(normals.Monthly))
+	}
+	mar := normals.Monthly[2]
+	if mar.Month != 3 || mar.TMin == nil || !approxEqual(*mar.TMin, 3.0, 0.001) || mar.TMinYears != 8 {
+		t.Errorf("unexpected March normal: %+v", mar)
+	}
+	// 4 odd years at 22 °C and 4 even years at 20 °C
+	if mar.TMax == nil || !approxEqual(*mar.TMax, 21.0, 0.001) {
+		t.Errorf("expected March TMax normal 21.0, got %v", mar.TMax)
+	}
+
+	// winter (DJF) 2001 starts in December 2000: (12 + 1 + 2) / 3 = 5.0
+	winter := normals.Seasonal[0]
+	if winter.Season != "Winter" || winter.TMin == nil || !approxEqual(*winter.TMin, 5.0, 0.001) || winter.TMinYears != 8 {
+		t.Errorf("unexpected winter normal: %+v", winter)
+	}
+	summer := normals.Seasonal[2]
+	if summer.Season != "Summer" || summer.TMin == nil || !approxEqual(*summer.TMin, 7.0, 0.001) {
+		t.Errorf("unexpected summer normal: %+v", summer)
+	}
+
+	// (1+2+...+12)/12 = 6.5
+	if normals.Annual.TMin == nil || !approxEqual(*normals.Annual.TMin, 6.5, 0.001) || normals.Annual.TMinYears != 8 {
+		t.Errorf("unexpected annual normal: %+v", normals.Annual)
+	}
+}
+
+func TestCalculateNormals_RequiresMinYears(t *testing.T) {
+	raw := completeYears(2000, 2004,
+		func(y int, m time.Month) int { return 100 },
+		func(y int, m time.Month) int { return 200 },
+	)
+	// January 2003 is incomplete and must not be counted
+	var filtered []RawStationData
+	for _, d := range raw {
+		if d.Date.Year() == 2003 && d.Date.Month() == time.January && d.Date.Day() < 15 {
+			continue
+		}
+		filtered = append(filtered, d)
+	}
+
+	normals := calculateNormals(newStationData(filtered), 2000, 2004, 5, false, defaultCompleteness)
+	jan := normals.Monthly[0]
+	if jan.TMinYears != 4 || jan.TMin != nil {
+		t.Errorf("expected no January normal from 4 of 5 years, got %+v", jan)
+	}
+	feb := normals.Monthly[1]
+	if feb.TMinYears != 5 || feb.TMin == nil || !approxEqual(*feb.TMin, 10.0, 0.001) {
+		t.Errorf("expected February normal 10.0 from 5 years, got %+v", feb)
+	}
+	if normals.Annual.TMinYears != 4 || normals.Annual.TMin != nil {
+		t.Errorf("expected no annual normal from 4 of 5 years, got %+v", normals.Annual)
+	}
+}
+
+func TestDefaultMinNormalsYears(t *testing.T) {
+	if n := defaultMinNormalsYears(1991, 2020); n != 24 {
+		t.Errorf("expected 24 of 30 years, got %d", n)
+	}
+	if n := defaultMinNormalsYears(2000, 2004); n != 4 {
+		t.Errorf("expected 4 of 5 years, got %d", n)
+	}
+}
+
+func TestParseNormalsPeriod(t *testing.T) {
+	from, to, err := parseNormalsPeriod(url.Values{})
+	if err != nil || from != 1991 || to != 2020 {
+		t.Errorf("expected default 1991–2020, got %d–%d (%v)", from, to, err)
+	}
+	from, to, err = parseNormalsPeriod(url.Values{"from": {"1961"}, "to": {"1990"}})
+	if err != nil || from != 1961 || to != 1990 {
+		t.Errorf("expected 1961–1990, got %d–%d (%v)", from, to, err)
+	}
+	if _, _, err := parseNormalsPeriod(url.Values{"from": {"2000"}, "to": {"1990"}}); err == nil {
+		t.Error("expected error for from after to")
+	}
+	if _, _, err := parseNormalsPeriod(url.Values{"from": {"abc"}}); err == nil {
+		t.Error("expected error for invalid year")
+	}
+}
+
+func TestNormalsHandler(t *testing.T) {
+	setupCache(t)
+
+	rawData := completeYears(2000, 2001,
+		func(y int, m time.Month) int { return 50 },
+		func(y int, m time.Month) int { return 150 },
+	)
+	cache.put("TESTSTATION", newStationData(rawData), stationVersion{}, time.Now())
+
+	req := httptest.NewRequest(http.MethodGet, "/station/normals?id=TESTSTATION&from=2000&to=2001", nil)
+	rec := httptest.NewRecorder()
+	normalsHandler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var resp struct {
+		Data     StationNormalsResponse `json:"data"`
+		ErrorMsg string                 `json:"errorMessage"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Data.MinYears != 2 {
+		t.Errorf("expected minYears 2, got %d", resp.Data.MinYears)
+	}
+	if resp.Data.Annual == nil || resp.Data.Annual.TMax == nil || !approxEqual(*resp.Data.Annual.TMax, 15.0, 0.001) {
+		t.Errorf("expected annual TMax normal 15.0, got %+v", resp.Data.Annual)
+	}
+
+	for _, query := range []string{"", "?id=TESTSTATION&from=2001&to=2000", "?id=TESTSTATION&minYears=5&from=2000&to=2001"} {
+		req := httptest.NewRequest(http.MethodGet, "/station/normals"+query, nil)
+		rec := httptest.NewRecorder()
+		normalsHandler(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%q: expected 400, got %d", query, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+)
+
+const parseBufferSize = 64 << 10
+
+// parseStationCSV reads a GHCN by_station CSV (ID, DATE, ELEMENT, DATA_VALUE,
+// M_FLAG, Q_FLAG, S_FLAG, OBS_TIME) into columns and keeps the rows of the
+// supported elements. It works on the raw line bytes instead of
+// encoding/csv: fields are sliced out of the read buffer and dates are parsed
+// from their digits, so rows do not allocate. Quoted and unquoted fields are
+// accepted, malformed rows and missing values (-9999) are skipped.
+func parseStationCSV(r io.Reader) (*stationData, error) {
+	br := bufio.NewReaderSize(r, parseBufferSize)
+	var b stationDataBuilder
+
+	for header := true; ; header = false {
+		line, err := br.ReadSlice('\n')
+		//no valid row is that long, skipping the rest of it
+		tooLong := false
+		for err == bufio.ErrBufferFull {
+			tooLong = true
+			_, err = br.ReadSlice('\n')
+		}
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("Lesefehler: %v", err)
+		}
+		if !header && !tooLong {
+			if row, ok := parseStationRow(line); ok {
+				b.add(row.element, row.day, row.value, row.m, row.q, row.s)
+			}
+		}
+		if err == io.EOF {
+			return b.data(), nil
+		}
+	}
+}
+
+// parsedRow is one observation, element indexes supportedElements
+type parsedRow struct {
+	element int
+	day     int32
+	value   int16
+	m, q, s byte
+}
+
+// parseStationRow parses one line, ok is false for rows to skip
+func parseStationRow(line []byte) (row parsedRow, ok bool) {
+	line = bytes.TrimRight(line, "\r\n")
+	if len(line) == 0 {
+		return row, false
+	}
+
+	var fields [7][]byte
+	n := 0
+	for n < len(fields) {
+		i := bytes.IndexByte(line, ',')
+		if i < 0 {
+			fields[n] = unquote(line)
+			n++
+			break
+		}
+		fields[n] = unquote(line[:i])
+		n++
+		line = line[i+1:]
+	}
+	if n < 4 {
+		return row, false
+	}
+
+	//filtering for temperature, precipitation and snow
+	row.element, ok = supportedElement(fields[2])
+	if !ok {
+		return row, false
+	}
+	row.day, ok = parseDate(fields[1])
+	if !ok {
+		return row, false
+	}
+	//skipping empty data, no valid value exceeds int16
+	val, ok := parseValue(fields[3])
+	if !ok || val == -9999 || val < math.MinInt16 || val > math.MaxInt16 {
+		return row, false
+	}
+	row.value = int16(val)
+
+	//flag columns are optional, blank flags stay 0
+	if n > 4 && len(fields[4]) > 0 {
+		row.m = fields[4][0]
+	}
+	if n > 5 && len(fields[5]) > 0 {
+		row.q = fields[5][0]
+	}
+	if n > 6 && len(fields[6]) > 0 {
+		row.s = fields[6][0]
+	}
+	return row, true
+}
+
+func unquote(field []byte) []byte {
+	if len(field) >= 2 && field[0] == '"' && field[len(field)-1] == '"' {
+		return field[1 : len(field)-1]
+	}
+	return field
+}
+
+// supportedElement returns the index of a supported element, the
+// comparison does not allocate
+func supportedElement(field []byte) (int, bool) {
+	for i, element := range supportedElements {
+		if string(field) == element {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// parseDate parses a valid YYYYMMDD date into days since 1970-01-01
+func parseDate(field []byte) (int32, bool) {
+	if len(field) != 8 {
+		return 0, false
+	}
+	var digits [8]int
+	for i, c := range field {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		digits[i] = int(c - '0')
+	}
+	year := digits[0]*1000 + digits[1]*100 + digits[2]*10 + digits[3]
+	month := digits[4]*10 + digits[5]
+	day := digits[6]*10 + digits[7]
+	if month < 1 || month > 12 || day < 1 || day > monthDays(year, month) {
+		return 0, false
+	}
+	return int32(daysSinceEpoch(year, month, day)), true
+}
+
+func monthDays(year, month int) int {
+	switch month {
+	case 2:
+		if year%4 == 0 && (year%100 != 0 || year%400 == 0) {
+			return 29
+		}
+		return 28
+	case 4, 6, 9, 11:
+		return 30
+	}
+	return 31
+}
+
+// daysSinceEpoch counts the days from 1970-01-01 in the proleptic Gregorian
+// calendar, years start in March so the leap day is the last day of a year
+func daysSinceEpoch(year, month, day int) int64 {
+	if month <= 2 {
+		year--
+	}
+	era := year / 400
+	if year < 0 {
+		era = (year - 399) / 400
+	}
+	yearOfEra := year - era*400
+	dayOfYear := (153*((month+9)%12)+2)/5 + day - 1
+	dayOfEra := yearOfEra*365 + yearOfEra/4 - yearOfEra/100 + dayOfYear
+	return int64(era*146097+dayOfEra) - 719468
+}
+
+// parseValue parses a signed integer of at most 9 digits
+func parseValue(field []byte) (int, bool) {
+	neg := false
+	if len(field) > 0 && (field[0] == '-' || field[0] == '+') {
+		neg = field[0] == '-'
+		field = field[1:]
+	}
+	if len(field) == 0 || len(field) > 9 {
+		return 0, false
+	}
+	val := 0
+	for _, c := range field {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		val = val*10 + int(c-'0')
+	}
+	if neg {
+		val = -val
+	}
+	return val, true
+}
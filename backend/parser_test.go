@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// parseStationCSVReference is the former encoding/csv implementation of
+// loadStationData, kept to check and benchmark parseStationCSV against
+func parseStationCSVReference(r io.Reader) []RawStationData {
+	reader := csv.NewReader(r)
+	var dataList []RawStationData
+	const layout = "20060102"
+
+	_, _ = reader.Read()
+
+	for {
+		line, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil || len(line) < 4 {
+			continue
+		}
+
+		element := line[2]
+		if !isSupportedElement(element) {
+			continue
+		}
+
+		date, err := time.Parse(layout, line[1])
+		if err != nil {
+			continue
+		}
+
+		val, err := strconv.Atoi(line[3])
+		if err != nil || val == -9999 {
+			continue
+		}
+
+		d := RawStationData{
+			Date:        date,
+			ElementType: element,
+			Value:       val,
+		}
+		if len(line) > 4 && line[4] != "" {
+			d.MFlag = line[4][0]
+		}
+		if len(line) > 5 && line[5] != "" {
+			d.QFlag = line[5][0]
+		}
+		if len(line) > 6 && line[6] != "" {
+			d.SFlag = line[6][0]
+		}
+		dataList = append(dataList, d)
+	}
+	return dataList
+}
+
+// stationCSV generates a by_station file with years of daily rows in the
+// unquoted format of the NOAA files, including elements that are skipped
+func stationCSV(years int) string {
+	var b strings.Builder
+	b.WriteString("ID,DATE,ELEMENT,DATA_VALUE,M_FLAG,Q_FLAG,S_FLAG,OBS_TIME\n")
+	day := time.Date(1920, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := day.AddDate(years, 0, 0)
+	for i := 0; day.Before(end); i++ {
+		date := day.Format("20060102")
+		for _, element := range []string{"TMAX", "TMIN", "PRCP", "SNOW", "SNWD", "TAVG", "WT01"} {
+			qflag := ""
+			if i%97 == 0 {
+				qflag = "I"
+			}
+			fmt.Fprintf(&b, "USW00094728,%s,%s,%d,,%s,7,0700\n", date, element, (i*7)%400-100, qflag)
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+	return b.String()
+}
+
+func TestParseStationCSV_MatchesEncodingCSV(t *testing.T) {
+	inputs := map[string]string{
+		"generated": stationCSV(3),
+		"quoted": `"ID","DATE","ELEMENT","DATA_VALUE","M_FLAG","Q_FLAG","S_FLAG","OBS_TIME"
+"STN001","20200101","TMIN",-15,"","","S",""
+"STN001","20200101","TMAX",+42,"T","G","0","0700"
+"STN001","20200102","TAVG",10,"","","S",""
+"STN001","20200102","PRCP",-9999,"","","S",""
+`,
+		"malformed": "ID,DATE,ELEMENT,DATA_VALUE,M_FLAG,Q_FLAG,S_FLAG,OBS_TIME\r\n" +
+			"STN001,20210230,TMIN,1,,,S,\r\n" + // no such day
+			"STN001,20201301,TMIN,1,,,S,\r\n" +
+			"STN001,2020010,TMIN,1,,,S,\r\n" +
+			"STN001,20200101,TMIN,abc,,,S,\r\n" +
+			"STN001,20200101,TMIN,,,,S,\r\n" +
+			"STN001,20200101\r\n" +
+			"\r\n" +
+			"STN001,20200229,SNWD,120,,,S,\r\n" +
+			"STN001,19000229,SNWD,120,,,S,\r\n" + // 1900 is no leap year
+			"STN001,20200301,SNOW,0,,,S,", // no final newline
+		"header only": "ID,DATE,ELEMENT,DATA_VALUE,M_FLAG,Q_FLAG,S_FLAG,OBS_TIME\n",
+		"empty":       "",
+	}
+	for name, input := range inputs {
+		got, err := parseStationCSV(strings.NewReader(input))
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", name, err)
+			continue
+		}
+		// the columns are ordered by date and element, not by file position
+		want := allRows(newStationData(parseStationCSVReference(strings.NewReader(input))))
+		if rows := allRows(got); !slices.Equal(rows, want) {
+			t.Errorf("%s: expected %+v, got %+v", name, want, rows)
+		}
+	}
+}
+
+func TestParseStationCSV_Rows(t *testing.T) {
+	input := "ID,DATE,ELEMENT,DATA_VALUE,M_FLAG,Q_FLAG,S_FLAG,OBS_TIME\n" +
+		"STN001,20200101,TMIN,-15,,,S,\n" +
+		"STN001,20200101,TMAX,42\n" + // short rows without flags are kept
+		"STN001," + strings.Repeat("9", parseBufferSize) + ",TMIN,1,,,S,\n" +
+		"STN001,20200102,PRCP,1234567890,,,S,\n" +
+		"STN001,20200103,PRCP,7,,,S,\n"
+	data, err := parseStationCSV(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	want := []RawStationData{
+		{Date: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), ElementType: "TMIN", Value: -15, SFlag: 'S'},
+		{Date: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), ElementType: "TMAX", Value: 42},
+		{Date: time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC), ElementType: "PRCP", Value: 7, SFlag: 'S'},
+	}
+	if got := allRows(data); !slices.Equal(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	for day := time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC); day.Year() < 2101; day = day.AddDate(0, 0, 1) {
+		if day.Year() == 3 {
+			day = time.Date(1599, 1, 1, 0, 0, 0, 0, time.UTC)
+		}
+		got, ok := parseDate([]byte(day.Format("20060102")))
+		if !ok || !dateOf(got).Equal(day) {
+			t.Fatalf("%s: got %v %v", day.Format("20060102"), got, ok)
+		}
+	}
+	for _, s := range []string{"20230229", "20200431", "20200001", "20200100", "2020-1-1", "2020010a", "99991232"} {
+		if _, ok := parseDate([]byte(s)); ok {
+			t.Errorf("%s: expected an invalid date", s)
+		}
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
+
+func TestParseStationCSV_ReadError(t *testing.T) {
+	r := io.MultiReader(strings.NewReader(stationCSV(1)), failingReader{})
+	if _, err := parseStationCSV(r); err == nil || !strings.Contains(err.Error(), "connection reset") {
+		t.Errorf("expected the read error, got %v", err)
+	}
+}
+
+func benchmarkParse(b *testing.B, parse func(io.Reader)) {
+	input := stationCSV(100)
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		parse(strings.NewReader(input))
+	}
+}
+
+func BenchmarkParseStationCSV(b *testing.B) {
+	benchmarkParse(b, func(r io.Reader) { parseStationCSV(r) })
+}
+
+func BenchmarkParseStationCSV_EncodingCSV(b *testing.B) {
+	benchmarkParse(b, func(r io.Reader) { parseStationCSVReference(r) })
+}
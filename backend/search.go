@@ -0,0 +1,316 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+	// distance in km at which the location bias costs half of its weight
+	searchBiasDistance = 1000.0
+	// maximum score a station can lose by being far away
+	searchBiasWeight = 20.0
+)
+
+// searchEntry holds the normalized name and ID of a station
+type searchEntry struct {
+	station *Station
+	id      string
+	name    string
+	words   []string
+}
+
+// SearchResult is a station matching a search, Score is higher for better matches
+type SearchResult struct {
+	*Station
+	Score float64 `json:"score"`
+}
+
+var (
+	// stations by their ID, rebuilt by indexStations
+	stationsByID = map[string]*Station{}
+	searchIndex  []searchEntry
+)
+
+// buildSearchIndex rebuilds the ID map and the normalized station names
+func buildSearchIndex(stations []*Station) {
+	byID := make(map[string]*Station, len(stations))
+	entries := make([]searchEntry, 0, len(stations))
+	for _, s := range stations {
+		byID[s.ID] = s
+		name := normalizeSearch(s.Name)
+		entries = append(entries, searchEntry{
+			station: s,
+			id:      normalizeSearch(s.ID),
+			name:    name,
+			words:   strings.Fields(name),
+		})
+	}
+	stationsByID = byID
+	searchIndex = entries
+}
+
+// accented letters not covered by a simple base letter
+var foldSpecial = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'œ': "oe", 'ø': "o", 'ł': "l", 'đ': "d", 'ð': "d", 'þ': "th", 'ı': "i",
+}
+
+// foldLatin maps accented latin letters to their base letter
+var foldLatin = map[rune]rune{}
+
+func init() {
+	groups := map[rune]string{
+		'a': "àáâãäåāăą",
+		'c': "çćĉċč",
+		'd': "ď",
+		'e': "èéêëēĕėęě",
+		'g': "ĝğġģ",
+		'h': "ĥħ",
+		'i': "ìíîïĩīĭį",
+		'j': "ĵ",
+		'k': "ķ",
+		'l': "ĺļľŀ",
+		'n': "ñńņňŉ",
+		'o': "òóôõöōŏő",
+		'r': "ŕŗř",
+		's': "śŝşšș",
+		't': "ţťŧț",
+		'u': "ùúûüũūŭůűų",
+		'w': "ŵ",
+		'y': "ýÿŷ",
+		'z': "źżž",
+	}
+	for base, letters := range groups {
+		for _, r := range letters {
+			foldLatin[r] = base
+		}
+	}
+}
+
+// normalizeSearch lowercases s, removes accents and replaces everything but
+// letters and digits by single spaces
+func normalizeSearch(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToLower(s) {
+		if base, ok := foldLatin[r]; ok {
+			r = base
+		}
+		if special, ok := foldSpecial[r]; ok {
+			b.WriteString(special)
+			space = false
+			continue
+		}
+		// combining accents of decomposed letters
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteRune(r)
+			space = false
+			continue
+		}
+		space = true
+	}
+	return b.String()
+}
+
+// levenshtein returns the edit distance of a and b, or max+1 if it is larger than max
+func levenshtein(a string, b string, max int) int {
+	ra, rb := []rune(a), []rune(b)
+	if diff := len(ra) - len(rb); diff > max || -diff > max {
+		return max + 1
+	}
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			rowMin = min(rowMin, cur[j])
+		}
+		if rowMin > max {
+			return max + 1
+		}
+		prev, cur = cur, prev
+	}
+	return min(prev[len(rb)], max+1)
+}
+
+// maxEdits is the number of typos tolerated in a search term
+func maxEdits(term string) int {
+	switch n := len([]rune(term)); {
+	case n < 4:
+		return 0
+	case n < 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// termScore rates how well a single search term matches one of the words
+func termScore(term string, words []string) float64 {
+	best := 0.0
+	edits := maxEdits(term)
+	for _, w := range words {
+		switch {
+		case w == term:
+			return 60
+		case strings.HasPrefix(w, term):
+			best = max(best, 50)
+		case edits > 0:
+			d := levenshtein(term, w, edits)
+			// typo within the first letters of a longer word
+			if prefix := []rune(w); len(prefix) > len([]rune(term)) {
+				d = min(d, levenshtein(term, string(prefix[:len([]rune(term))]), edits))
+			}
+			if d <= edits {
+				best = max(best, 40-10*float64(d))
+			}
+		}
+	}
+	return best
+}
+
+// matchScore rates how well the normalized query matches the station,
+// 0 means no match
+func (e *searchEntry) matchScore(query string, terms []string) float64 {
+	switch {
+	case e.id == query:
+		return 100
+	case strings.HasPrefix(e.id, query):
+		return 90
+	case e.name == query:
+		return 80
+	case strings.HasPrefix(e.name, query):
+		return 70
+	}
+	// every term has to match a word, the weakest term decides
+	score := 0.0
+	for i, term := range terms {
+		s := termScore(term, e.words)
+		if s == 0 {
+			return 0
+		}
+		if i == 0 || s < score {
+			score = s
+		}
+	}
+	return score
+}
+
+// searchStations returns the best matches for the query. If bias is set the
+// score is lowered with the distance to lat/long.
+func searchStations(query string, limit int, bias bool, lat float64, long float64) []*SearchResult {
+	query = normalizeSearch(query)
+	terms := strings.Fields(query)
+	if len(terms) == 0 {
+		return []*SearchResult{}
+	}
+
+	results := []*SearchResult{}
+	for i := range searchIndex {
+		e := &searchIndex[i]
+		score := e.matchScore(query, terms)
+		if score == 0 {
+			continue
+		}
+		station := *e.station
+		result := &SearchResult{Station: &station, Score: score}
+		if bias && e.station.Latitude != nil && e.station.Longitude != nil {
+			distance := haversine(lat, long, *e.station.Latitude, *e.station.Longitude)
+			result.Distance = distance
+			result.Score -= searchBiasWeight * distance / (distance + searchBiasDistance)
+		}
+		results = append(results, result)
+	}
+
+	slices.SortFunc(results, func(a, b *SearchResult) int {
+		if a.Score != b.Score {
+			if a.Score > b.Score {
+				return -1
+			}
+			return 1
+		}
+		if c := strings.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// searchHandler serves /stations/search?q=...&limit=...&lat=...&long=...
+func searchHandler(w http.ResponseWriter, r *http.Request) {
+	//cors handling
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+	q := r.URL.Query()
+	query := q.Get("q")
+	limitStr := q.Get("limit")
+	latStr := q.Get("lat")
+	longStr := q.Get("long")
+	enc := json.NewEncoder(w)
+
+	if strings.TrimSpace(query) == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		response := Response{Data: []*SearchResult{}, ErrorMsg: "Please provide a search term."}
+		enc.Encode(response)
+		return
+	}
+	limit := defaultSearchLimit
+	if limitStr != "" {
+		l, err := strconv.Atoi(limitStr)
+		if err != nil || l < 1 || l > maxSearchLimit {
+			w.WriteHeader(http.StatusBadRequest)
+			response := Response{Data: []*SearchResult{}, ErrorMsg: "Please provide a limit between 1 and 100."}
+			enc.Encode(response)
+			return
+		}
+		limit = l
+	}
+
+	var lat, long float64
+	bias := latStr != "" || longStr != ""
+	if bias {
+		var errLat, errLong error
+		lat, errLat = strconv.ParseFloat(latStr, 64)
+		long, errLong = strconv.ParseFloat(longStr, 64)
+		if errLat != nil || errLong != nil || checkPosition(long, lat) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			response := Response{Data: []*SearchResult{}, ErrorMsg: "Please provide a valid latitude and longitude."}
+			enc.Encode(response)
+			return
+		}
+	}
+
+	results := searchStations(query, limit, bias, lat, long)
+	errMsg := ""
+	if len(results) == 0 {
+		errMsg = "No stations found matching your search."
+	}
+	response := Response{Data: results, ErrorMsg: errMsg}
+	enc.Encode(response)
+}
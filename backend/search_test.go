@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNormalizeSearch(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"BERLIN-TEMPELHOF", "berlin tempelhof"},
+		{"  München  Flughafen ", "munchen flughafen"},
+		{"São Paulo", "sao paulo"},
+		{"Straße", "strasse"},
+		{"Zürich", "zurich"},
+		{"ST. JOHN'S", "st john s"},
+		{"GM000003342", "gm000003342"},
+	}
+	for _, tt := range tests {
+		if got := normalizeSearch(tt.in); got != tt.want {
+			t.Errorf("normalizeSearch(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		max  int
+		want int
+	}{
+		{"berlin", "berlin", 2, 0},
+		{"berlin", "berlim", 2, 1},
+		{"berlin", "brelin", 2, 2},
+		{"munchen", "muenchen", 2, 1},
+		{"berlin", "paris", 2, 3},
+		{"a", "abcdef", 2, 3},
+	}
+	for _, tt := range tests {
+		if got := levenshtein(tt.a, tt.b, tt.max); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+// searchTestStations sets up stations with two Berlins far apart
+func searchTestStations(t *testing.T) {
+	coords := []float64{52.47, 13.40, 44.47, -71.18, 48.14, 11.58, -23.63, -46.66}
+	setupGlobalState(t,
+		[]*Station{
+			{ID: "GM000003319", Name: "BERLIN-TEMPELHOF", Latitude: &coords[0], Longitude: &coords[1]},
+			{ID: "USC00270690", Name: "BERLIN", Latitude: &coords[2], Longitude: &coords[3]},
+			{ID: "GM000004199", Name: "MUENCHEN-STADT", Latitude: &coords[4], Longitude: &coords[5]},
+			{ID: "BR00E3-0520", Name: "SAO PAULO", Latitude: &coords[6], Longitude: &coords[7]},
+		},
+		map[string]*StationInventory{},
+	)
+}
+
+func TestSearchStations_Ranking(t *testing.T) {
+	searchTestStations(t)
+
+	results := searchStations("berlin", 10, false, 0, 0)
+	if len(results) != 2 || results[0].ID != "USC00270690" || results[1].ID != "GM000003319" {
+		t.Fatalf("expected exact name match first, got %v", results)
+	}
+	if results[0].Score <= results[1].Score {
+		t.Errorf("expected a higher score for the exact match, got %v and %v", results[0].Score, results[1].Score)
+	}
+
+	// biased towards Germany the prefix match in Berlin wins
+	results = searchStations("berlin", 10, true, 52.5, 13.4)
+	if results[0].ID != "GM000003319" || results[0].Distance > 10 {
+		t.Errorf("expected Berlin-Tempelhof first with location bias, got %v", results[0])
+	}
+}
+
+func TestSearchStations_Matching(t *testing.T) {
+	searchTestStations(t)
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"GM000004199", "GM000004199"},
+		{"gm0000041", "GM000004199"},
+		{"tempelhof", "GM000003319"},
+		{"berlin tempel", "GM000003319"},
+		{"München", "GM000004199"},
+		{"São Paulo", "BR00E3-0520"},
+		{"tempelhfo", "GM000003319"},
+	}
+	for _, tt := range tests {
+		results := searchStations(tt.query, 10, false, 0, 0)
+		if len(results) == 0 || results[0].ID != tt.want {
+			t.Errorf("%q: expected %s first, got %v", tt.query, tt.want, results)
+		}
+	}
+
+	for _, query := range []string{"xyz", "paris", "berlin paris", "  "} {
+		if results := searchStations(query, 10, false, 0, 0); len(results) != 0 {
+			t.Errorf("%q: expected no results, got %d", query, len(results))
+		}
+	}
+
+	if results := searchStations("s", 1, false, 0, 0); len(results) != 1 {
+		t.Errorf("expected limit 1 to apply, got %d", len(results))
+	}
+}
+
+func TestSearchHandler(t *testing.T) {
+	searchTestStations(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/stations/search?q=berlin&lat=52.5&long=13.4&limit=1", nil)
+	rec := httptest.NewRecorder()
+	searchHandler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var resp struct {
+		Data     []*SearchResult `json:"data"`
+		ErrorMsg string          `json:"errorMessage"`
+	}
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if len(resp.Data) != 1 || resp.Data[0].ID != "GM000003319" || resp.Data[0].Name != "BERLIN-TEMPELHOF" {
+		t.Errorf("unexpected result %+v", resp.Data)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/stations/search?q=nowhere", nil)
+	rec = httptest.NewRecorder()
+	searchHandler(rec, req)
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if rec.Code != http.StatusOK || resp.ErrorMsg == "" {
+		t.Errorf("expected 200 with an error message, got %d %q", rec.Code, resp.ErrorMsg)
+	}
+
+	for _, query := range []string{"", "?q=", "?q=berlin&limit=0", "?q=berlin&limit=abc", "?q=berlin&lat=52", "?q=berlin&lat=95&long=0"} {
+		req := httptest.NewRequest(http.MethodGet, "/stations/search"+query, nil)
+		rec := httptest.NewRecorder()
+		searchHandler(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%q: expected 400, got %d", query, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// root of the GHCN-Daily files in NOAA's S3 bucket
+const defaultDataURL = "https://noaa-ghcn-pds.s3.amazonaws.com"
+
+// dataSource provides the GHCN-Daily files, from S3 or from a local mirror
+type dataSource interface {
+	// open returns a file of the GHCN root like "ghcnd-stations.txt"
+	open(name string) (io.ReadCloser, error)
+	// openStation returns the uncompressed by_station CSV of the station and
+	// its version, or errNotModified if the file still matches prev
+	openStation(id string, prev stationVersion) (io.ReadCloser, stationVersion, error)
+}
+
+// stationVersion identifies a version of a station file for conditional
+// requests, empty fields are unknown
+type stationVersion struct {
+	ETag         string
+	LastModified string
+}
+
+// errNotModified is returned by openStation if the file has not changed
+var errNotModified = errors.New("Station nicht geändert")
+
+// source all GHCN files are read from, set by newDataSource on start up
+var source dataSource = &httpSource{baseURL: defaultDataURL}
+
+// newDataSource selects the data source from the environment: METEO_DATA_DIR
+// reads a local mirror, otherwise the files are downloaded from
+// METEO_DATA_URL (default NOAA's S3 bucket).
+func newDataSource() (dataSource, error) {
+	if dir := os.Getenv("METEO_DATA_DIR"); dir != "" {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return nil, fmt.Errorf("Datenverzeichnis %s nicht lesbar: %v", dir, err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("%s ist kein Verzeichnis", dir)
+		}
+		return &dirSource{dir: dir}, nil
+	}
+	if url := os.Getenv("METEO_DATA_URL"); url != "" {
+		return &httpSource{baseURL: strings.TrimSuffix(url, "/")}, nil
+	}
+	return &httpSource{baseURL: defaultDataURL}, nil
+}
+
+// checkStationID rejects IDs that could leave the station directory
+func checkStationID(id string) error {
+	if id == "" || strings.ContainsAny(id, `/\.`) {
+		return fmt.Errorf("ungültige Station %q", id)
+	}
+	return nil
+}
+
+// httpSource downloads the files below baseURL. Station files are fetched
+// from the gzip compressed csv.gz/by_station/ first and from csv/by_station/
+// if the compressed file of that station does not exist.
+type httpSource struct {
+	baseURL string
+}
+
+func (h *httpSource) open(name string) (io.ReadCloser, error) {
+	url := h.baseURL + "/" + name
+	resp, err := httpClient.get(url)
+	if errors.Is(err, errSourceUnavailable) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Netzwerkfehler: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("Datei %s nicht gefunden (Status %d)", url, resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+func (h *httpSource) openStation(id string, prev stationVersion) (io.ReadCloser, stationVersion, error) {
+	if err := checkStationID(id); err != nil {
+		return nil, stationVersion{}, err
+	}
+	urls := []string{
+		fmt.Sprintf("%s/csv.gz/by_station/%s.csv.gz", h.baseURL, id),
+		fmt.Sprintf("%s/csv/by_station/%s.csv", h.baseURL, id),
+	}
+
+	for i, url := range urls {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return nil, stationVersion{}, err
+		}
+		//conditional request, S3 answers 304 if the file has not changed
+		if prev.ETag != "" {
+			req.Header.Set("If-None-Match", prev.ETag)
+		}
+		if prev.LastModified != "" {
+			req.Header.Set("If-Modified-Since", prev.LastModified)
+		}
+
+		resp, err := httpClient.do(req)
+		if errors.Is(err, errSourceUnavailable) {
+			return nil, stationVersion{}, err
+		}
+		if err != nil {
+			return nil, stationVersion{}, fmt.Errorf("Netzwerkfehler: %v", err)
+		}
+		if resp.StatusCode == http.StatusNotModified {
+			resp.Body.Close()
+			return nil, prev, errNotModified
+		}
+		//falling back to the uncompressed file
+		if resp.StatusCode == http.StatusNotFound && i < len(urls)-1 {
+			resp.Body.Close()
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, stationVersion{}, fmt.Errorf("Station %s nicht gefunden (Status %d)", id, resp.StatusCode)
+		}
+
+		version := stationVersion{ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}
+		body, err := sniffGzip(resp.Body)
+		return body, version, err
+	}
+	return nil, stationVersion{}, fmt.Errorf("Station %s nicht gefunden", id)
+}
+
+// dirSource reads a local copy of the GHCN files. The station CSVs are looked
+// up in by_station/, csv/by_station/ or csv.gz/by_station/, optionally gzip
+// compressed.
+type dirSource struct {
+	dir string
+}
+
+func (d *dirSource) open(name string) (io.ReadCloser, error) {
+	path := filepath.Join(d.dir, name)
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("Datei %s nicht gefunden", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Datei %s nicht lesbar: %v", path, err)
+	}
+	return f, nil
+}
+
+// openStation uses the modification time of the file as its version
+func (d *dirSource) openStation(id string, prev stationVersion) (io.ReadCloser, stationVersion, error) {
+	if err := checkStationID(id); err != nil {
+		return nil, stationVersion{}, err
+	}
+	for _, dir := range []string{"by_station", filepath.Join("csv", "by_station"), filepath.Join("csv.gz", "by_station")} {
+		for _, ext := range []string{".csv", ".csv.gz"} {
+			f, err := os.Open(filepath.Join(d.dir, dir, id+ext))
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return nil, stationVersion{}, fmt.Errorf("Station %s nicht lesbar: %v", id, err)
+			}
+			var version stationVersion
+			if info, err := f.Stat(); err == nil {
+				version.LastModified = info.ModTime().UTC().Format(http.TimeFormat)
+			}
+			if version.LastModified != "" && version.LastModified == prev.LastModified {
+				f.Close()
+				return nil, prev, errNotModified
+			}
+			if ext == ".csv" {
+				return f, version, nil
+			}
+			rc, err := newGzipReadCloser(f)
+			return rc, version, err
+		}
+	}
+	return nil, stationVersion{}, fmt.Errorf("Station %s nicht gefunden", id)
+}
+
+// sniffGzip decompresses rc if it starts with the gzip magic bytes. Servers
+// deliver .csv.gz files already decoded if they are stored with a gzip
+// Content-Encoding, and plain files may be sent gzip encoded, so neither the
+// extension nor the headers are reliable.
+func sniffGzip(rc io.ReadCloser) (io.ReadCloser, error) {
+	br := bufio.NewReader(rc)
+	body := &readCloser{Reader: br, Closer: rc}
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		return newGzipReadCloser(body)
+	}
+	return body, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// gzipReadCloser closes both the gzip reader and the underlying file
+type gzipReadCloser struct {
+	*gzip.Reader
+	file io.Closer
+}
+
+func newGzipReadCloser(rc io.ReadCloser) (io.ReadCloser, error) {
+	zr, err := gzip.NewReader(rc)
+	if err != nil {
+		rc.Close()
+		return nil, fmt.Errorf("gzip-Fehler: %v", err)
+	}
+	return &gzipReadCloser{Reader: zr, file: rc}, nil
+}
+
+func (g *gzipReadCloser) Close() error {
+	err := g.Reader.Close()
+	if cerr := g.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const sourceTestCSV = `"ID","DATE","ELEMENT","DATA_VALUE","M_FLAG","Q_FLAG","S_FLAG","OBS_TIME"
+"GM000003342","20200101","TMIN",-15,"","","E",""
+"GM000003342","20200101","TMAX",42,"","","E",""
+`
+
+// writeFile creates the file with all parent directories
+func writeFile(t *testing.T, path string, content []byte) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func gzipped(t *testing.T, s string) []byte {
+	t.Helper()
+	var b strings.Builder
+	zw := gzip.NewWriter(&b)
+	if _, err := zw.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return []byte(b.String())
+}
+
+func TestDirSource_OpenStation(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "by_station", "PLAIN.csv"), []byte(sourceTestCSV))
+	writeFile(t, filepath.Join(dir, "by_station", "ZIPPED.csv.gz"), gzipped(t, sourceTestCSV))
+	writeFile(t, filepath.Join(dir, "csv", "by_station", "MIRROR.csv"), []byte(sourceTestCSV))
+	writeFile(t, filepath.Join(dir, "csv.gz", "by_station", "NOAA.csv.gz"), gzipped(t, sourceTestCSV))
+	src := &dirSource{dir: dir}
+
+	for _, id := range []string{"PLAIN", "ZIPPED", "MIRROR", "NOAA"} {
+		data, _, err := loadStationData(src, id, stationVersion{})
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", id, err)
+			continue
+		}
+		if data.len() != 2 || allRows(data)[0].Value != -15 || allRows(data)[1].SFlag != 'E' {
+			t.Errorf("%s: unexpected data %+v", id, data)
+		}
+	}
+
+	if _, _, err := src.openStation("MISSING", stationVersion{}); err == nil || !strings.Contains(err.Error(), "nicht gefunden") {
+		t.Errorf("expected not found error, got %v", err)
+	}
+	for _, id := range []string{"../secret", "a/b", ""} {
+		if _, _, err := src.openStation(id, stationVersion{}); err == nil {
+			t.Errorf("%q: expected error for invalid station ID", id)
+		}
+	}
+}
+
+func TestDirSource_BrokenGzip(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "by_station", "BROKEN.csv.gz"), []byte("not gzip"))
+	if _, _, err := (&dirSource{dir: dir}).openStation("BROKEN", stationVersion{}); err == nil {
+		t.Error("expected error for a broken gzip file")
+	}
+}
+
+func TestDirSource_StartUpFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "ghcnd-inventory.txt"), []byte(
+		"GM000003342  48.1500   11.5500 TMAX 1900 2023\n"+
+			"GM000003342  48.1500   11.5500 TMIN 1900 2023\n"+
+			"GM000003342  48.1500   11.5500 AWND 1990 2023\n"))
+	writeFile(t, filepath.Join(dir, "ghcnd-stations.txt"), []byte(
+		"GM000003342  48.1500   11.5500  515.0    MUENCHEN                       GSN     10865\n"))
+	writeFile(t, filepath.Join(dir, "ghcnd-countries.txt"), []byte("GM Germany\n"))
+	writeFile(t, filepath.Join(dir, "ghcnd-states.txt"), []byte("AB ALBERTA\n"))
+
+	setupSource(t, &dirSource{dir: dir})
+	setupGlobalState(t, nil, map[string]*StationInventory{})
+	oldCountries, oldStates := countryNames, stateNames
+	t.Cleanup(func() { countryNames, stateNames = oldCountries, oldStates })
+
+	if err := loadInventory(); err != nil {
+		t.Fatalf("loadInventory: %v", err)
+	}
+	if err := loadCountries(); err != nil {
+		t.Fatalf("loadCountries: %v", err)
+	}
+	if err := initStations(); err != nil {
+		t.Fatalf("initStations: %v", err)
+	}
+
+	inv := inventoryMap["GM000003342"]
+	if inv == nil || len(inv.Elements) != 2 || inv.Elements["TMAX"].FirstYear != 1900 {
+		t.Errorf("unexpected inventory %+v", inv)
+	}
+	if len(allStations) != 1 || allStations[0].Name != "MUENCHEN" || allStations[0].CountryName != "Germany" {
+		t.Errorf("unexpected stations %+v", allStations)
+	}
+	if stateNames["AB"] != "ALBERTA" {
+		t.Errorf("unexpected states %v", stateNames)
+	}
+
+	setupSource(t, &dirSource{dir: t.TempDir()})
+	if err := loadInventory(); err == nil {
+		t.Error("expected error for a missing inventory file")
+	}
+}
+
+func TestHTTPSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ghcnd-states.txt" {
+			w.Write([]byte("AB ALBERTA\n"))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+	src := &httpSource{baseURL: server.URL}
+
+	body, err := src.open("ghcnd-states.txt")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	content, _ := io.ReadAll(body)
+	body.Close()
+	if string(content) != "AB ALBERTA\n" {
+		t.Errorf("unexpected content %q", content)
+	}
+
+	if _, err := src.open("ghcnd-stations.txt"); err == nil || !strings.Contains(err.Error(), "Status 404") {
+		t.Errorf("expected 404 error, got %v", err)
+	}
+	if _, _, err := src.openStation("../ghcnd-states", stationVersion{}); err == nil {
+		t.Error("expected error for invalid station ID")
+	}
+}
+
+func TestHTTPSource_ConditionalGet(t *testing.T) {
+	modTime := time.Date(2025, 6, 1, 10, 0, 0, 0, time.UTC)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "STN001.csv", modTime, strings.NewReader(sourceTestCSV))
+	}))
+	defer server.Close()
+	src := &httpSource{baseURL: server.URL}
+
+	data, version, err := loadStationData(src, "STN001", stationVersion{})
+	if err != nil || data.len() != 2 {
+		t.Fatalf("unexpected result %v %v", data, err)
+	}
+	if version.ETag != `"v1"` || version.LastModified != modTime.Format(http.TimeFormat) {
+		t.Errorf("unexpected version %+v", version)
+	}
+
+	// the same version is answered with 304
+	if _, got, err := loadStationData(src, "STN001", version); !errors.Is(err, errNotModified) || got != version {
+		t.Errorf("expected errNotModified, got %v %+v", err, got)
+	}
+	if _, _, err := loadStationData(src, "STN001", stationVersion{ETag: `"v0"`}); err != nil {
+		t.Errorf("expected a download for another ETag, got %v", err)
+	}
+}
+
+func TestDirSource_NotModified(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "by_station", "PLAIN.csv")
+	writeFile(t, path, []byte(sourceTestCSV))
+	src := &dirSource{dir: dir}
+
+	_, version, err := loadStationData(src, "PLAIN", stationVersion{})
+	if err != nil || version.LastModified == "" {
+		t.Fatalf("expected a version, got %+v %v", version, err)
+	}
+	if _, _, err := loadStationData(src, "PLAIN", version); !errors.Is(err, errNotModified) {
+		t.Errorf("expected errNotModified, got %v", err)
+	}
+
+	// a newer file is read again
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(path, later, later)
+	if data, _, err := loadStationData(src, "PLAIN", version); err != nil || data.len() != 2 {
+		t.Errorf("expected the changed file, got %v %v", data, err)
+	}
+}
+
+func TestHTTPSource_GzipStationFiles(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/csv.gz/by_station/ZIPPED.csv.gz":
+			w.Write(gzipped(t, sourceTestCSV))
+		case "/csv.gz/by_station/ENCODED.csv.gz":
+			// stored with a gzip Content-Encoding, the client decodes it
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(gzipped(t, sourceTestCSV))
+		case "/csv.gz/by_station/OTHER.csv.gz":
+			w.Write(gzipped(t, sourceTestCSV))
+		case "/csv/by_station/PLAIN.csv", "/csv/by_station/OTHER.csv":
+			w.Write([]byte(sourceTestCSV))
+		case "/csv/by_station/TRANSFER.csv":
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(gzipped(t, sourceTestCSV))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	for _, id := range []string{"ZIPPED", "ENCODED", "PLAIN", "TRANSFER"} {
+		data, _, err := loadStationData(&httpSource{baseURL: server.URL}, id, stationVersion{})
+		if err != nil || data.len() != 2 || allRows(data)[0].Value != -15 {
+			t.Errorf("%s: unexpected result %+v %v", id, data, err)
+		}
+	}
+
+	// a missing compressed file only affects its own station
+	src := &httpSource{baseURL: server.URL}
+	mu.Lock()
+	paths = nil
+	mu.Unlock()
+	for _, id := range []string{"PLAIN", "OTHER", "PLAIN"} {
+		loadStationData(src, id, stationVersion{})
+	}
+	want := []string{
+		"/csv.gz/by_station/PLAIN.csv.gz", "/csv/by_station/PLAIN.csv",
+		"/csv.gz/by_station/OTHER.csv.gz",
+		"/csv.gz/by_station/PLAIN.csv.gz", "/csv/by_station/PLAIN.csv",
+	}
+	if !slices.Equal(paths, want) {
+		t.Errorf("unexpected requests %v", paths)
+	}
+
+	if _, _, err := loadStationData(src, "MISSING", stationVersion{}); err == nil || !strings.Contains(err.Error(), "Status 404") {
+		t.Errorf("expected 404 error, got %v", err)
+	}
+}
+
+func TestSniffGzip(t *testing.T) {
+	for _, content := range [][]byte{[]byte(sourceTestCSV), gzipped(t, sourceTestCSV), {}} {
+		body, err := sniffGzip(io.NopCloser(bytes.NewReader(content)))
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		got, _ := io.ReadAll(body)
+		body.Close()
+		if len(content) > 0 && string(got) != sourceTestCSV {
+			t.Errorf("unexpected content %q", got)
+		}
+	}
+	if _, err := sniffGzip(io.NopCloser(bytes.NewReader([]byte{0x1f, 0x8b, 0}))); err == nil {
+		t.Error("expected error for a broken gzip stream")
+	}
+}
+
+func TestNewDataSource(t *testing.T) {
+	t.Setenv("METEO_DATA_DIR", "")
+	t.Setenv("METEO_DATA_URL", "")
+	src, err := newDataSource()
+	if h, ok := src.(*httpSource); err != nil || !ok || h.baseURL != defaultDataURL {
+		t.Errorf("expected the default S3 source, got %+v %v", src, err)
+	}
+
+	t.Setenv("METEO_DATA_URL", "http://mirror.local/ghcn/")
+	src, _ = newDataSource()
+	if h, ok := src.(*httpSource); !ok || h.baseURL != "http://mirror.local/ghcn" {
+		t.Errorf("expected the mirror URL, got %+v", src)
+	}
+
+	dir := t.TempDir()
+	t.Setenv("METEO_DATA_DIR", dir)
+	src, _ = newDataSource()
+	if d, ok := src.(*dirSource); !ok || d.dir != dir {
+		t.Errorf("expected a directory source, got %+v", src)
+	}
+
+	t.Setenv("METEO_DATA_DIR", filepath.Join(dir, "missing"))
+	if _, err := newDataSource(); err == nil {
+		t.Error("expected error for a missing directory")
+	}
+}
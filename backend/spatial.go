@@ -0,0 +1,104 @@
+package main
+
+import (
+	"math"
+)
+
+const earthRadius = 6371.0
+
+// size of a grid cell in degrees
+const gridCellSize = 1.0
+
+const (
+	gridRows = int(180 / gridCellSize)
+	gridCols = int(360 / gridCellSize)
+)
+
+// stationGrid buckets the stations into latitude/longitude cells, so a radius
+// query only has to look at the cells around the search point.
+type stationGrid struct {
+	cells [][]*Station
+}
+
+// spatial index over allStations, rebuilt by indexStations
+var stationIndex = buildStationGrid(nil)
+
+// indexStations rebuilds the spatial and search indexes of allStations,
+// called after initStations
+func indexStations() {
+	stationIndex = buildStationGrid(allStations)
+	buildSearchIndex(allStations)
+}
+
+func buildStationGrid(stations []*Station) *stationGrid {
+	g := &stationGrid{cells: make([][]*Station, gridRows*gridCols)}
+	for _, s := range stations {
+		if s.Latitude == nil || s.Longitude == nil {
+			continue
+		}
+		i := gridRow(*s.Latitude)*gridCols + gridCol(*s.Longitude)
+		g.cells[i] = append(g.cells[i], s)
+	}
+	return g
+}
+
+func gridRow(lat float64) int {
+	row := int(math.Floor((lat + 90) / gridCellSize))
+	return min(max(row, 0), gridRows-1)
+}
+
+func gridCol(long float64) int {
+	col := int(math.Floor((long + 180) / gridCellSize))
+	return ((col % gridCols) + gridCols) % gridCols
+}
+
+// haversine returns the great circle distance between two points in km
+func haversine(lat1 float64, long1 float64, lat2 float64, long2 float64) float64 {
+	const p = math.Pi / 180
+
+	dLat := (lat1 - lat2) * p
+	dLong := (long1 - long2) * p
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*p)*math.Cos(lat2*p)*
+			math.Sin(dLong/2)*math.Sin(dLong/2)
+
+	return earthRadius * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+// withinRadius calls fn for every station within radius km of the point.
+// Stations are visited cell by cell, not ordered by distance.
+func (g *stationGrid) withinRadius(lat float64, long float64, radius float64, fn func(s *Station, distance float64)) {
+	// angular radius of the search circle
+	angle := radius / earthRadius
+	dLat := angle * 180 / math.Pi
+
+	minRow := gridRow(lat - dLat)
+	maxRow := gridRow(lat + dLat)
+
+	// longitude half width of the bounding box, the whole circle of latitude
+	// if the search circle contains a pole
+	cols := gridCols
+	firstCol := 0
+	if lat-dLat > -90 && lat+dLat < 90 && angle < math.Pi/2 {
+		ratio := math.Sin(angle) / math.Cos(lat*math.Pi/180)
+		if ratio < 1 {
+			dLong := math.Asin(ratio) * 180 / math.Pi
+			firstCol = int(math.Floor((long - dLong + 180) / gridCellSize))
+			lastCol := int(math.Floor((long + dLong + 180) / gridCellSize))
+			cols = min(lastCol-firstCol+1, gridCols)
+		}
+	}
+
+	for row := minRow; row <= maxRow; row++ {
+		for c := 0; c < cols; c++ {
+			col := (((firstCol + c) % gridCols) + gridCols) % gridCols
+			for _, s := range g.cells[row*gridCols+col] {
+				distance := haversine(lat, long, *s.Latitude, *s.Longitude)
+				if distance <= radius {
+					fn(s, distance)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// randomStations returns n stations spread uniformly over the globe
+func randomStations(n int, seed int64) []*Station {
+	rng := rand.New(rand.NewSource(seed))
+	stations := make([]*Station, n)
+	for i := range stations {
+		lat := rng.Float64()*180 - 90
+		long := rng.Float64()*360 - 180
+		stations[i] = &Station{ID: fmt.Sprintf("RND%08d", i), Latitude: &lat, Longitude: &long}
+	}
+	return stations
+}
+
+// bruteForce returns all stations within radius by a linear scan
+func bruteForce(stations []*Station, lat float64, long float64, radius float64) []*Station {
+	var result []*Station
+	for _, s := range stations {
+		if haversine(lat, long, *s.Latitude, *s.Longitude) <= radius {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+func TestHaversine(t *testing.T) {
+	// Berlin - Paris ~878 km
+	if d := haversine(52.52, 13.405, 48.8566, 2.3522); !approxEqual(d, 878, 2) {
+		t.Errorf("expected ~878 km, got %f", d)
+	}
+	// across the antimeridian
+	if d := haversine(0, 179.5, 0, -179.5); !approxEqual(d, 111.2, 0.1) {
+		t.Errorf("expected ~111.2 km, got %f", d)
+	}
+}
+
+func TestGridCol_Wraps(t *testing.T) {
+	if gridCol(180) != 0 || gridCol(-180) != 0 || gridCol(179.9) != gridCols-1 {
+		t.Errorf("unexpected columns %d %d %d", gridCol(180), gridCol(-180), gridCol(179.9))
+	}
+	if gridRow(90) != gridRows-1 || gridRow(-90) != 0 {
+		t.Errorf("unexpected rows %d %d", gridRow(90), gridRow(-90))
+	}
+}
+
+func TestStationGrid_MatchesLinearScan(t *testing.T) {
+	stations := randomStations(20000, 1)
+	grid := buildStationGrid(stations)
+
+	queries := []struct {
+		name      string
+		lat, long float64
+		radius    float64
+	}{
+		{"Berlin", 52.52, 13.405, 300},
+		{"antimeridian east", 10, 179.9, 500},
+		{"antimeridian west", -10, -179.9, 500},
+		{"north pole", 89.5, 0, 400},
+		{"south pole", -89.9, 45, 200},
+		{"high latitude", 80, -100, 1000},
+		{"half the globe", 0, 0, 12000},
+		{"whole globe", 0, 0, 25000},
+		{"zero radius", 0, 0, 0},
+	}
+	for _, q := range queries {
+		t.Run(q.name, func(t *testing.T) {
+			var got []*Station
+			grid.withinRadius(q.lat, q.long, q.radius, func(s *Station, distance float64) {
+				got = append(got, s)
+			})
+			want := bruteForce(stations, q.lat, q.long, q.radius)
+
+			byID := func(a, b *Station) int { return strings.Compare(a.ID, b.ID) }
+			slices.SortFunc(got, byID)
+			slices.SortFunc(want, byID)
+			if !slices.Equal(got, want) {
+				t.Errorf("grid found %d stations, linear scan %d", len(got), len(want))
+			}
+		})
+	}
+}
+
+func TestStationGrid_SkipsStationsWithoutCoordinates(t *testing.T) {
+	lat := 52.52
+	grid := buildStationGrid([]*Station{{ID: "NOLONG", Latitude: &lat}})
+	count := 0
+	grid.withinRadius(52.52, 13.405, 25000, func(s *Station, distance float64) { count++ })
+	if count != 0 {
+		t.Errorf("expected no stations, got %d", count)
+	}
+}
+
+func BenchmarkStationGrid_WithinRadius(b *testing.B) {
+	stations := randomStations(120000, 1)
+	grid := buildStationGrid(stations)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		count := 0
+		grid.withinRadius(52.52, 13.405, 100, func(s *Station, distance float64) { count++ })
+	}
+}
+
+func BenchmarkLinearScan_WithinRadius(b *testing.B) {
+	stations := randomStations(120000, 1)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bruteForce(stations, 52.52, 13.405, 100)
+	}
+}
+
+func BenchmarkFindStations(b *testing.B) {
+	stations := randomStations(120000, 1)
+	inventory := make(map[string]*StationInventory, len(stations))
+	for _, s := range stations {
+		inventory[s.ID] = temperatureInventory(1900, 2024)
+	}
+	oldStations, oldInventory := allStations, inventoryMap
+	allStations, inventoryMap = stations, inventory
+	indexStations()
+	b.Cleanup(func() {
+		allStations, inventoryMap = oldStations, oldInventory
+		indexStations()
+	})
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		findStations(52.52, 13.405, 100, 10, stationFilter{StartYear: 1950, EndYear: 2000})
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"slices"
+	"strconv"
+)
+
+// a trend needs at least this many yearly values
+const minTrendValues = 5
+
+// confidence level of the trend intervals
+const trendConfidence = 0.95
+
+// TrendStatistics describes the linear trend of a yearly series.
+// Slopes and their 95 % confidence intervals are given in units per decade.
+type TrendStatistics struct {
+	Values       int      `json:"values"`
+	FirstYear    int      `json:"firstYear"`
+	LastYear     int      `json:"lastYear"`
+	OLSSlope     *float64 `json:"olsSlope"`
+	OLSLower     *float64 `json:"olsLower"`
+	OLSUpper     *float64 `json:"olsUpper"`
+	SenSlope     *float64 `json:"senSlope"`
+	SenLower     *float64 `json:"senLower"`
+	SenUpper     *float64 `json:"senUpper"`
+	MannKendallZ *float64 `json:"mannKendallZ"`
+	MannKendallP *float64 `json:"mannKendallP"`
+}
+
+// TrendAnalysis holds the TMIN/TMAX trends of the annual series and of every
+// season, optionally restricted to the years start–end.
+type TrendAnalysis struct {
+	StartYear *int                                   `json:"startYear,omitempty"`
+	EndYear   *int                                   `json:"endYear,omitempty"`
+	Annual    map[string]*TrendStatistics            `json:"annual"`
+	Seasonal  map[string]map[string]*TrendStatistics `json:"seasonal"`
+}
+
+// elements the trend analysis is calculated for
+var trendElements = []string{"TMIN", "TMAX"}
+
+// calculateTrendAnalysis computes the trends of the annual and seasonal series.
+// start and end may be nil for an open window.
+func calculateTrendAnalysis(annual []*AnnualStationData, seasonal []*SeasonalStationData, start *int, end *int) *TrendAnalysis {
+	analysis := &TrendAnalysis{
+		StartYear: start,
+		EndYear:   end,
+		Annual:    make(map[string]*TrendStatistics),
+		Seasonal:  make(map[string]map[string]*TrendStatistics),
+	}
+	inWindow := func(year int) bool {
+		return (start == nil || year >= *start) && (end == nil || year <= *end)
+	}
+
+	for _, element := range trendElements {
+		var years, values []float64
+		for _, a := range annual {
+			if val := *annualValues(a)[element]; val != nil && inWindow(a.Year) {
+				years = append(years, float64(a.Year))
+				values = append(values, *val)
+			}
+		}
+		if stats := calculateTrend(years, values); stats != nil {
+			analysis.Annual[element] = stats
+		}
+	}
+
+	for _, season := range []string{"Winter", "Spring", "Summer", "Autumn"} {
+		for _, element := range trendElements {
+			var years, values []float64
+			for _, s := range seasonal {
+				if val := *seasonalValues(s)[element]; s.Season == season && val != nil && inWindow(s.Year) {
+					years = append(years, float64(s.Year))
+					values = append(values, *val)
+				}
+			}
+			stats := calculateTrend(years, values)
+			if stats == nil {
+				continue
+			}
+			if _, ok := analysis.Seasonal[season]; !ok {
+				analysis.Seasonal[season] = make(map[string]*TrendStatistics)
+			}
+			analysis.Seasonal[season][element] = stats
+		}
+	}
+	return analysis
+}
+
+// calculateTrend computes OLS and Theil–Sen slopes with confidence intervals
+// and the Mann–Kendall significance of a series. The years must be ascending.
+// Returns nil if there are fewer than minTrendValues values.
+func calculateTrend(years []float64, values []float64) *TrendStatistics {
+	n := len(values)
+	if n < minTrendValues {
+		return nil
+	}
+	stats := &TrendStatistics{Values: n, FirstYear: int(years[0]), LastYear: int(years[n-1])}
+	perDecade := func(v float64, digits float64) *float64 {
+		r := math.Round(v*10*digits) / digits
+		return &r
+	}
+
+	// ordinary least squares
+	var meanX, meanY float64
+	for i := range values {
+		meanX += years[i]
+		meanY += values[i]
+	}
+	meanX /= float64(n)
+	meanY /= float64(n)
+	var sxx, sxy float64
+	for i := range values {
+		sxx += (years[i] - meanX) * (years[i] - meanX)
+		sxy += (years[i] - meanX) * (values[i] - meanY)
+	}
+	if sxx == 0 {
+		return nil
+	}
+	slope := sxy / sxx
+	var sse float64
+	for i := range values {
+		r := values[i] - (meanY + slope*(years[i]-meanX))
+		sse += r * r
+	}
+	se := math.Sqrt(sse/float64(n-2)) / math.Sqrt(sxx)
+	t := studentTQuantile(1-(1-trendConfidence)/2, float64(n-2))
+	stats.OLSSlope = perDecade(slope, 1000)
+	stats.OLSLower = perDecade(slope-t*se, 1000)
+	stats.OLSUpper = perDecade(slope+t*se, 1000)
+
+	// Theil–Sen slope and Mann–Kendall test
+	var slopes []float64
+	s := 0
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			diff := values[j] - values[i]
+			if diff > 0 {
+				s++
+			} else if diff < 0 {
+				s--
+			}
+			if years[j] != years[i] {
+				slopes = append(slopes, diff/(years[j]-years[i]))
+			}
+		}
+	}
+	slices.Sort(slopes)
+	varS := mannKendallVariance(values)
+	stats.SenSlope = perDecade(median(slopes), 1000)
+
+	// confidence interval after Gilbert (1987): ranks (N' ∓ C) / 2
+	z := math.Sqrt2 * math.Erfinv(trendConfidence)
+	c := z * math.Sqrt(varS)
+	lower := int(math.Round((float64(len(slopes))-c)/2)) - 1
+	upper := int(math.Round((float64(len(slopes)) + c) / 2))
+	if lower >= 0 && upper < len(slopes) {
+		stats.SenLower = perDecade(slopes[lower], 1000)
+		stats.SenUpper = perDecade(slopes[upper], 1000)
+	}
+
+	var zScore float64
+	if varS > 0 {
+		switch {
+		case s > 0:
+			zScore = float64(s-1) / math.Sqrt(varS)
+		case s < 0:
+			zScore = float64(s+1) / math.Sqrt(varS)
+		}
+	}
+	p := math.Erfc(math.Abs(zScore) / math.Sqrt2)
+	zRounded := math.Round(zScore*1000) / 1000
+	pRounded := math.Round(p*10000) / 10000
+	stats.MannKendallZ = &zRounded
+	stats.MannKendallP = &pRounded
+	return stats
+}
+
+// mannKendallVariance returns the variance of the Mann–Kendall S statistic,
+// corrected for tied values.
+func mannKendallVariance(values []float64) float64 {
+	n := float64(len(values))
+	v := n * (n - 1) * (2*n + 5)
+	ties := make(map[float64]int)
+	for _, val := range values {
+		ties[val]++
+	}
+	for _, t := range ties {
+		if t > 1 {
+			tf := float64(t)
+			v -= tf * (tf - 1) * (2*tf + 5)
+		}
+	}
+	return v / 18
+}
+
+// median of an ascending sorted slice
+func median(sorted []float64) float64 {
+	n := len(sorted)
+	if n == 0 {
+		return math.NaN()
+	}
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// studentTQuantile returns the p-quantile of Student's t distribution with
+// df degrees of freedom (p > 0.5), found by bisection of the CDF.
+func studentTQuantile(p float64, df float64) float64 {
+	lo, hi := 0.0, 1.0
+	for studentTCDF(hi, df) < p {
+		hi *= 2
+	}
+	for i := 0; i < 100; i++ {
+		mid := (lo + hi) / 2
+		if studentTCDF(mid, df) < p {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return (lo + hi) / 2
+}
+
+// studentTCDF returns P(T <= t) for t >= 0
+func studentTCDF(t float64, df float64) float64 {
+	return 1 - 0.5*regularizedIncompleteBeta(df/(df+t*t), df/2, 0.5)
+}
+
+// regularizedIncompleteBeta evaluates I_x(a, b) with the continued fraction
+// expansion (Numerical Recipes, betacf).
+func regularizedIncompleteBeta(x float64, a float64, b float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	lga, _ := math.Lgamma(a)
+	lgb, _ := math.Lgamma(b)
+	lgab, _ := math.Lgamma(a + b)
+	front := math.Exp(lgab - lga - lgb + a*math.Log(x) + b*math.Log(1-x))
+	if x > (a+1)/(a+b+2) {
+		return 1 - front*betaContinuedFraction(1-x, b, a)/b
+	}
+	return front * betaContinuedFraction(x, a, b) / a
+}
+
+func betaContinuedFraction(x float64, a float64, b float64) float64 {
+	const (
+		maxIterations = 200
+		epsilon       = 1e-14
+		tiny          = 1e-300
+	)
+	qab, qap, qam := a+b, a+1, a-1
+	c, d := 1.0, 1-qab*x/qap
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	h := d
+	for m := 1; m <= maxIterations; m++ {
+		mf := float64(m)
+		m2 := 2 * mf
+		aa := mf * (b - mf) * x / ((qam + m2) * (a + m2))
+		d = 1 + aa*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + aa/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		h *= d * c
+		aa = -(a + mf) * (qab + mf) * x / ((a + m2) * (qap + m2))
+		d = 1 + aa*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + aa/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		del := d * c
+		h *= del
+		if math.Abs(del-1) < epsilon {
+			break
+		}
+	}
+	return h
+}
+
+// parseTrendWindow reads the optional trendStart/trendEnd years.
+func parseTrendWindow(q url.Values) (*int, *int, error) {
+	var start, end *int
+	if s := q.Get("trendStart"); s != "" {
+		year, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid trendStart year %q", s)
+		}
+		start = &year
+	}
+	if s := q.Get("trendEnd"); s != "" {
+		year, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid trendEnd year %q", s)
+		}
+		end = &year
+	}
+	if start != nil && end != nil && *end < *start {
+		return nil, nil, fmt.Errorf("trendStart %d is after trendEnd %d", *start, *end)
+	}
+	return start, end, nil
+}
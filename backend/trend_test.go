@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestStudentTQuantile(t *testing.T) {
+	tests := []struct {
+		df       float64
+		expected float64
+	}{
+		{1, 12.706},
+		{5, 2.571},
+		{10, 2.228},
+		{30, 2.042},
+		{1000, 1.962},
+	}
+	for _, tc := range tests {
+		if q := studentTQuantile(0.975, tc.df); !approxEqual(q, tc.expected, 0.001) {
+			t.Errorf("df=%v: expected %.3f, got %.4f", tc.df, tc.expected, q)
+		}
+	}
+}
+
+func TestCalculateTrend_TooFewValues(t *testing.T) {
+	if stats := calculateTrend([]float64{2000, 2001, 2002}, []float64{1, 2, 3}); stats != nil {
+		t.Errorf("expected nil for 3 values, got %+v", stats)
+	}
+}
+
+func TestCalculateTrend_PerfectLinearSeries(t *testing.T) {
+	// +0.03 °C per year = +0.3 °C per decade
+	var years, values []float64
+	for y := 2000; y < 2010; y++ {
+		years = append(years, float64(y))
+		values = append(values, 10+0.03*float64(y-2000))
+	}
+
+	stats := calculateTrend(years, values)
+	if stats == nil {
+		t.Fatal("expected trend statistics")
+	}
+	if stats.Values != 10 || stats.FirstYear != 2000 || stats.LastYear != 2009 {
+		t.Errorf("unexpected series info: %+v", stats)
+	}
+	if !approxEqual(*stats.OLSSlope, 0.3, 1e-9) || !approxEqual(*stats.SenSlope, 0.3, 1e-9) {
+		t.Errorf("expected slopes of 0.3/decade, got OLS %f, Sen %f", *stats.OLSSlope, *stats.SenSlope)
+	}
+	// no residuals -> zero width interval
+	if !approxEqual(*stats.OLSLower, 0.3, 1e-9) || !approxEqual(*stats.OLSUpper, 0.3, 1e-9) {
+		t.Errorf("expected degenerate OLS interval, got [%f, %f]", *stats.OLSLower, *stats.OLSUpper)
+	}
+	// S = 45, Var(S) = 125, Z = 44 / sqrt(125) = 3.935
+	if !approxEqual(*stats.MannKendallZ, 3.935, 0.001) {
+		t.Errorf("expected Z 3.935, got %f", *stats.MannKendallZ)
+	}
+	if *stats.MannKendallP > 0.001 {
+		t.Errorf("expected p < 0.001 for a monotonic series, got %f", *stats.MannKendallP)
+	}
+}
+
+func TestCalculateTrend_NoisySeries(t *testing.T) {
+	years := []float64{2000, 2001, 2002, 2003, 2004, 2005, 2006, 2007}
+	values := []float64{1.0, 3.0, 2.0, 4.0, 3.0, 5.0, 4.0, 6.0}
+
+	stats := calculateTrend(years, values)
+	// OLS slope per year = 24 / 42 = 0.5714 -> 5.714 per decade
+	if !approxEqual(*stats.OLSSlope, 5.714, 0.001) {
+		t.Errorf("expected OLS slope 5.714, got %f", *stats.OLSSlope)
+	}
+	if *stats.OLSLower >= *stats.OLSSlope || *stats.OLSUpper <= *stats.OLSSlope {
+		t.Errorf("expected slope inside interval, got [%f, %f]", *stats.OLSLower, *stats.OLSUpper)
+	}
+	if stats.SenLower == nil || stats.SenUpper == nil || *stats.SenLower > *stats.SenSlope || *stats.SenUpper < *stats.SenSlope {
+		t.Errorf("expected Sen slope inside its interval, got %v [%v, %v]", *stats.SenSlope, stats.SenLower, stats.SenUpper)
+	}
+	if *stats.MannKendallP > 0.05 {
+		t.Errorf("expected significant trend, got p=%f", *stats.MannKendallP)
+	}
+}
+
+func TestCalculateTrend_NoTrend(t *testing.T) {
+	years := []float64{2000, 2001, 2002, 2003, 2004, 2005}
+	values := []float64{5, 5, 5, 5, 5, 5}
+
+	stats := calculateTrend(years, values)
+	if *stats.SenSlope != 0 || *stats.OLSSlope != 0 {
+		t.Errorf("expected zero slopes, got OLS %f, Sen %f", *stats.OLSSlope, *stats.SenSlope)
+	}
+	if *stats.MannKendallP != 1 {
+		t.Errorf("expected p=1 for a constant series, got %f", *stats.MannKendallP)
+	}
+}
+
+func TestMannKendallVariance_TieCorrection(t *testing.T) {
+	// n=5 without ties: 5*4*15/18
+	if v := mannKendallVariance([]float64{1, 2, 3, 4, 5}); !approxEqual(v, 300.0/18, 1e-9) {
+		t.Errorf("unexpected variance %f", v)
+	}
+	// one pair of ties: (300 - 2*1*9)/18
+	if v := mannKendallVariance([]float64{1, 2, 2, 4, 5}); !approxEqual(v, 282.0/18, 1e-9) {
+		t.Errorf("unexpected tie corrected variance %f", v)
+	}
+}
+
+func TestCalculateTrendAnalysis_Window(t *testing.T) {
+	var annual []*AnnualStationData
+	var seasonal []*SeasonalStationData
+	for y := 1990; y < 2010; y++ {
+		tmax := 10.0
+		if y >= 2000 {
+			tmax = 10 + 0.1*float64(y-2000)
+		}
+		annual = append(annual, &AnnualStationData{Year: y, TMax: floatPtr(tmax)})
+		seasonal = append(seasonal, &SeasonalStationData{Year: y, Season: "Summer", TMin: floatPtr(float64(y - 1990))})
+	}
+
+	start := 2000
+	analysis := calculateTrendAnalysis(annual, seasonal, &start, nil)
+	tmax := analysis.Annual["TMAX"]
+	if tmax == nil || tmax.Values != 10 || !approxEqual(*tmax.OLSSlope, 1.0, 1e-9) {
+		t.Errorf("expected TMAX trend of 1.0/decade since 2000, got %+v", tmax)
+	}
+	if _, ok := analysis.Annual["TMIN"]; ok {
+		t.Error("expected no TMIN trend without TMIN values")
+	}
+	summer := analysis.Seasonal["Summer"]["TMIN"]
+	if summer == nil || !approxEqual(*summer.SenSlope, 10.0, 1e-9) {
+		t.Errorf("expected summer TMIN trend of 10/decade, got %+v", summer)
+	}
+	if _, ok := analysis.Seasonal["Winter"]; ok {
+		t.Error("expected no winter trends without winter values")
+	}
+}
+
+func TestParseTrendWindow(t *testing.T) {
+	start, end, err := parseTrendWindow(url.Values{})
+	if err != nil || start != nil || end != nil {
+		t.Errorf("expected open window, got %v %v (%v)", start, end, err)
+	}
+	start, end, err = parseTrendWindow(url.Values{"trendStart": {"1970"}, "trendEnd": {"2020"}})
+	if err != nil || *start != 1970 || *end != 2020 {
+		t.Errorf("expected 1970–2020, got %v %v (%v)", start, end, err)
+	}
+	if _, _, err := parseTrendWindow(url.Values{"trendStart": {"2020"}, "trendEnd": {"1970"}}); err == nil {
+		t.Error("expected error for start after end")
+	}
+}
+
+func TestStationHandler_ReturnsAnalysis(t *testing.T) {
+	setupCache(t)
+
+	rawData := completeYears(2000, 2005,
+		func(y int, m time.Month) int { return (y - 2000) * 10 },
+		func(y int, m time.Month) int { return 200 },
+	)
+	cache.put("TESTSTATION", newStationData(rawData), stationVersion{}, time.Now())
+
+	req := httptest.NewRequest(http.MethodGet, "/station?id=TESTSTATION&trendEnd=2005", nil)
+	rec := httptest.NewRecorder()
+	stationHandler(rec, req)
+
+	var resp struct {
+		Data StationDetailResponse `json:"data"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Data.Analysis == nil {
+		t.Fatal("expected analysis block")
+	}
+	tmin := resp.Data.Analysis.Annual["TMIN"]
+	if tmin == nil || !approxEqual(*tmin.OLSSlope, 10.0, 1e-9) {
+		t.Errorf("expected TMIN trend 10 °C/decade, got %+v", tmin)
+	}
+	if p := *resp.Data.Analysis.Annual["TMAX"].MannKendallP; math.Abs(p-1) > 1e-9 {
+		t.Errorf("expected no TMAX trend, got p=%f", p)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/station?id=TESTSTATION&trendStart=abc", nil)
+	rec = httptest.NewRecorder()
+	stationHandler(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid trend window, got %d", rec.Code)
+	}
+}